@@ -3,8 +3,8 @@
 package indexdb
 
 import (
-	"sync"
 	"syscall/js"
+	"time"
 
 	"github.com/tinywasm/fmt"
 	. "github.com/tinywasm/model"
@@ -20,13 +20,39 @@ type adapter struct {
 
 	compiler *compiler
 
-	initDone      chan struct{}
-	initOnce      sync.Once
-	initCompleted bool
+	specs     []*storeSpec
+	version   int
+	batchSize int
+
+	subs      []*subscription
+	channel   js.Value // BroadcastChannel shared with other tabs
+	onMessage js.Func
+
+	versionPolicy    VersionPolicy
+	versionHandler   func(VersionEvent)
+	versionListener  js.Func
+	versionListening bool
+
+	timeout time.Duration
+	connErr error // why the connection is unusable; nil when open
+
+	txTimeout time.Duration
+	txs       map[*transaction]bool // open transactions, aborted by Close
+
+	encryptionKey []byte
+	cipher        *fieldCipher
+	codecs        map[string]map[string]Codec // table -> field -> recorded codec
+
+	initDone chan struct{}
 }
 
 // Exec implements storage.Executor
 func (d *adapter) Exec(query string, args ...any) error {
+	return d.exec(nil, args...)
+}
+
+// exec runs a write query inside t, or in its own transaction when t is nil.
+func (d *adapter) exec(t *transaction, args ...any) error {
 	if len(args) == 0 {
 		return fmt.Err("no query passed")
 	}
@@ -42,7 +68,7 @@ func (d *adapter) Exec(query string, args ...any) error {
 		return fmt.Err("invalid model type")
 	}
 
-	return d.execute(q, m, nil, nil, nil)
+	return d.execute(t, q, m, nil, nil, nil)
 }
 
 // simpleScanner implements storage.Scanner
@@ -60,6 +86,11 @@ func (s *simpleScanner) Scan(dest ...any) error {
 
 // QueryRow implements storage.Executor
 func (d *adapter) QueryRow(query string, args ...any) storage.Scanner {
+	return d.queryRow(nil, args...)
+}
+
+// queryRow reads a single row inside t, or in its own transaction when t is nil.
+func (d *adapter) queryRow(t *transaction, args ...any) storage.Scanner {
 	if len(args) == 0 {
 		return &simpleScanner{err: fmt.Err("no query passed")}
 	}
@@ -75,7 +106,7 @@ func (d *adapter) QueryRow(query string, args ...any) storage.Scanner {
 		return &simpleScanner{err: fmt.Err("invalid model type")}
 	}
 
-	err := d.execute(q, m, nil, nil, nil)
+	err := d.execute(t, q, m, nil, nil, nil)
 	return &simpleScanner{err: err}
 }
 
@@ -100,74 +131,15 @@ func (r *simpleRows) Next() bool {
 }
 
 func (r *simpleRows) Scan(dest ...any) error {
-	if r.idx == 0 || (r.idx > len(r.models) && r.idx > len(r.values)) {
+	if r.idx == 0 || r.idx > len(r.values) {
 		return fmt.Err("invalid row cursor")
 	}
-
-	if len(r.models) > 0 {
-		m := r.models[r.idx-1]
-		ptrs := m.Pointers()
-		if len(ptrs) != len(dest) {
-			return fmt.Err("scan destination mismatch")
-		}
-
-		for i, p := range ptrs {
-			destPtr := dest[i]
-			srcPtr := p
-
-			switch d := destPtr.(type) {
-			case *string:
-				*d = *(srcPtr.(*string))
-			case *int:
-				*d = *(srcPtr.(*int))
-			case *int64:
-				*d = *(srcPtr.(*int64))
-			case *float64:
-				*d = *(srcPtr.(*float64))
-			case *bool:
-				*d = *(srcPtr.(*bool))
-			case *any:
-				*d = *(srcPtr.(*any))
-			}
-		}
-		return nil
-	}
-
-	val := r.values[r.idx-1]
 	if len(r.fields) != len(dest) {
 		return fmt.Err("scan destination mismatch with fields")
 	}
-
-	for i, field := range r.fields {
-		jsVal := val.Get(field.Name)
-		if jsVal.IsUndefined() {
-			continue
-		}
-
-		destPtr := dest[i]
-		switch field.Type.Storage() {
-		case FieldText:
-			if p, ok := destPtr.(*string); ok {
-				*p = jsVal.String()
-			}
-		case FieldInt:
-			if p, ok := destPtr.(*int64); ok {
-				*p = int64(jsVal.Int())
-			} else if p, ok := destPtr.(*int); ok {
-				*p = jsVal.Int()
-			}
-		case FieldFloat:
-			if p, ok := destPtr.(*float64); ok {
-				*p = jsVal.Float()
-			}
-		case FieldBool:
-			if p, ok := destPtr.(*bool); ok {
-				*p = jsVal.Bool()
-			}
-		}
-	}
-
-	return nil
+	// Decode from the stored record so every field type scans the same way
+	// whether or not a factory built models for the rows.
+	return scanRecord(r.values[r.idx-1], r.fields, dest)
 }
 
 func (r *simpleRows) Columns() ([]string, error) {
@@ -183,6 +155,11 @@ func (r *simpleRows) Err() error   { return nil }
 
 // Query implements storage.Executor
 func (d *adapter) Query(query string, args ...any) (storage.Rows, error) {
+	return d.query(nil, args...)
+}
+
+// query reads rows inside t, or in its own transaction when t is nil.
+func (d *adapter) query(t *transaction, args ...any) (storage.Rows, error) {
 	if len(args) == 0 {
 		return nil, fmt.Err("no query passed")
 	}
@@ -198,6 +175,20 @@ func (d *adapter) Query(query string, args ...any) (storage.Rows, error) {
 		return nil, fmt.Err("invalid model type")
 	}
 
+	fields, _, err := projection(q, m)
+	if err != nil {
+		return nil, err
+	}
+
+	// Stream straight from the cursor whenever no in-memory sort is needed.
+	rows, ok, err := d.streamRows(t, q, fields)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return rows, nil
+	}
+
 	var models []Model
 	var values []js.Value
 	var factory func() Model
@@ -215,13 +206,12 @@ func (d *adapter) Query(query string, args ...any) (storage.Rows, error) {
 		each = func(model Model) {
 			models = append(models, model)
 		}
-	} else {
-		eachJS = func(val js.Value) {
-			values = append(values, val)
-		}
+	}
+	eachJS = func(val js.Value) {
+		values = append(values, val)
 	}
 
-	err := d.execute(q, m, factory, each, eachJS)
+	err = d.execute(t, q, m, factory, each, eachJS)
 	if err != nil {
 		return nil, err
 	}
@@ -229,15 +219,23 @@ func (d *adapter) Query(query string, args ...any) (storage.Rows, error) {
 	return &simpleRows{
 		models: models,
 		values: values,
-		fields: m.Schema(),
+		fields: fields,
 		idx:    0,
 	}, nil
 }
 
-// Close implements storage.Executor
+// Close implements storage.Executor. Open transactions are rolled back.
 func (d *adapter) Close() error {
+	d.closeChannel()
+	d.stopVersionWatch()
+	// An open transaction would keep the connection from ever closing.
+	for t := range d.txs {
+		t.abort()
+	}
 	if d.db.Truthy() {
 		d.db.Call("close")
+		d.db = js.Value{}
+		d.connErr = fmt.Err("connection to", d.dbName, "is closed")
 	}
 	return nil
 }
@@ -253,6 +251,7 @@ func newAdapter(dbName string, idg IDGenerator, logger func(...any)) *adapter {
 		db:       js.Value{},
 		idGen:    idg,
 		logger:   logger,
+		txs:      make(map[*transaction]bool),
 		initDone: make(chan struct{}),
 	}
 }
@@ -270,6 +269,9 @@ func (d *adapter) Compile(q storage.Query, m Model) (storage.Plan, error) {
 }
 
 // New initializes the IndexedDB database and returns a storage.Conn instance.
+// structTables are the models to declare as object stores; Option values may
+// be mixed in to configure the adapter. New blocks until the database is
+// open; if opening fails every operation on the connection returns the error.
 func New(dbName string, idg IDGenerator, logger func(...any), structTables ...any) storage.Conn {
 	adapter := newAdapter(dbName, idg, logger)
 	adapter.compiler = &compiler{}
@@ -277,137 +279,186 @@ func New(dbName string, idg IDGenerator, logger func(...any), structTables ...an
 	return adapter
 }
 
-// initialize initializes the IndexedDB database and creates object stores based on the provided structs.
-func (d *adapter) initialize(structTables ...any) {
-	d.tables = structTables
-
-	// Open connection to IndexedDB
-	req := js.Global().Get("indexedDB").Call("open", d.dbName)
-
-	// Add event listeners
-	req.Call("addEventListener", "error", js.FuncOf(d.onShowDbError))
-	req.Call("addEventListener", "success", js.FuncOf(d.onOpenExistingDB))
-	req.Call("addEventListener", "upgradeneeded", js.FuncOf(d.onUpgradeNeeded))
+// Open is the non-blocking form of New: it returns the connection at once and
+// opens the database in the background. The channel receives nil once the
+// connection is ready, or the open error. Operations issued earlier wait for
+// the outcome and return the open error if there is one.
+func Open(dbName string, idg IDGenerator, logger func(...any), structTables ...any) (storage.Conn, <-chan error) {
+	adapter := newAdapter(dbName, idg, logger)
+	adapter.compiler = &compiler{}
 
-	// Wait until init is done
-	<-d.initDone
+	ready := make(chan error, 1)
+	go func() {
+		adapter.initialize(structTables...)
+		ready <- adapter.connErr
+	}()
+	return adapter, ready
 }
 
-func (d *adapter) open(p *js.Value, message string) error {
-	d.db = p.Get("target").Get("result")
-
-	if !d.db.Truthy() {
-		return fmt.Err("error open", d.dbName, message)
+// initialize opens the IndexedDB database and brings its object stores in line
+// with the provided structs, upgrading the schema version when they changed.
+func (d *adapter) initialize(structTables ...any) {
+	for _, t := range structTables {
+		if opt, ok := t.(Option); ok {
+			opt(d)
+			continue
+		}
+		d.tables = append(d.tables, t)
 	}
-	return nil
-}
-
-func (d *adapter) onUpgradeNeeded(this js.Value, p []js.Value) any {
-	// The event is fired on the request object, so 'this' is the request.
-	// p[0] is the event object.
+	if d.encryptionKey != nil {
+		c, err := newFieldCipher(d.encryptionKey)
+		if err != nil {
+			d.logger(err)
+			d.connErr = err
+			close(d.initDone)
+			return
+		}
+		d.cipher = c
+	}
+	d.buildSpecs()
+	d.openChannel()
 
-	// We need to set d.db before creating tables, as the connection is opened in upgrade needed transaction
-	err := d.open(&p[0], "upgradeneeded")
+	err := d.open()
+	if err == nil {
+		err = d.loadCodecs()
+	}
 	if err != nil {
 		d.logger(err)
-		return nil
+		d.connErr = err
 	}
+	close(d.initDone)
+}
 
-	for i, table := range d.tables {
-		m, ok := table.(Model)
-		if !ok {
-			d.logger("table", i, "does not implement Model interface, skipping")
-			continue
+// open connects to the database, upgrading it when the declared schema is
+// newer than the one on disk.
+//
+// A pinned Version is authoritative: an upgrade to it rebuilds changed
+// stores and indexes and drops the stores an earlier schema recorded but this
+// one no longer declares. A database already past that version is opened as
+// it is. Without a Version upgrades are additive only, so a tab running an
+// older build or a worker declaring some of the models never drops or alters
+// what other callers declared.
+func (d *adapter) open() error {
+	if d.version > 0 {
+		err := d.openDB(d.version)
+		if e, ok := err.(*StoreError); ok && e.Name == "VersionError" {
+			d.logger(d.dbName, "is newer than version", d.version, "- opening it without upgrading")
+			err = d.openDB(0)
 		}
-
-		err := d.createTable(m)
 		if err != nil {
-			d.logger(err)
-			continue
+			return err
+		}
+		if d.schemaDrifted() {
+			d.logger("schema of", d.dbName, "differs from version", d.version, "- bump Version to migrate")
 		}
+		return nil
 	}
 
-	// Wait for the version change transaction to complete
-	transaction := p[0].Get("target").Get("transaction")
-	transaction.Call("addEventListener", "complete", js.FuncOf(func(this js.Value, p []js.Value) any {
-		d.initOnce.Do(func() { d.initCompleted = true; close(d.initDone) })
-		return nil
-	}))
-	transaction.Call("addEventListener", "error", js.FuncOf(func(this js.Value, p []js.Value) any {
-		d.logger("version change transaction error")
-		d.initOnce.Do(func() { d.initCompleted = true; close(d.initDone) })
-		return nil
-	}))
-	transaction.Call("addEventListener", "abort", js.FuncOf(func(this js.Value, p []js.Value) any {
-		d.logger("version change transaction aborted")
-		d.initOnce.Do(func() { d.initCompleted = true; close(d.initDone) })
+	if err := d.openDB(0); err != nil {
+		return err
+	}
+	if !d.schemaMissing() {
+		if d.schemaDrifted() {
+			d.logger("schema of", d.dbName, "differs from the declared models - pin a higher Version to migrate")
+		}
 		return nil
-	}))
-
-	return nil
-}
+	}
 
-func (d *adapter) onShowDbError(this js.Value, p []js.Value) any {
-	d.logger("indexDB Error", p[0])
-	return nil
+	next := d.db.Get("version").Int() + 1
+	d.db.Call("close")
+	d.db = js.Value{}
+	return d.openDB(next)
 }
 
-func (d *adapter) onOpenExistingDB(this js.Value, p []js.Value) any {
-	err := d.open(&p[0], "OPEN")
-	if err != nil {
-		d.logger("open existing db error:", err)
-		return nil
+// ready waits for initialization and reports why the connection is not
+// usable, if it is not: the open error, a close forced by a version change
+// in another tab, or an explicit Close.
+func (d *adapter) ready() error {
+	<-d.initDone
+	if d.connErr != nil {
+		return d.connErr
 	}
-
-	if !d.initCompleted {
-		d.logger("open existing db success")
+	if !d.db.Truthy() {
+		return fmt.Err("Database not initialized")
 	}
-
-	d.initOnce.Do(func() { d.initCompleted = true; close(d.initDone) })
 	return nil
 }
 
-// createTable creates an IndexedDB object store from the model's Schema.
-func (d *adapter) createTable(m Model) error {
-	if d.initCompleted {
-		return fmt.Err("Dynamic table creation after initialization is not supported in IndexedDB adapter")
+// openDB opens the database at version (0 opens the current one) and blocks
+// until the connection is ready. When the version grows, upgradeneeded
+// reconciles the object stores before success fires.
+//
+// With a Timeout the wait is bounded. An abandoned request may still settle
+// later: its connection is then closed and a pending upgrade aborted.
+func (d *adapter) openDB(version int) error {
+	idb := js.Global().Get("indexedDB")
+	if !idb.Truthy() {
+		return fmt.Err("IndexedDB not available")
+	}
+
+	var req js.Value
+	if version > 0 {
+		req = idb.Call("open", d.dbName, version)
+	} else {
+		req = idb.Call("open", d.dbName)
 	}
 
-	fields := m.Schema()
-	tableName := m.ModelName()
-
-	pkName := ""
-	for _, f := range fields {
-		if f.IsPK() {
-			pkName = f.Name
-			break
-		}
-	}
-	if pkName == "" {
-		return fmt.Err("no primary key found in schema for table", tableName)
+	done := make(chan error, 1)
+	abandoned := false
+	var funcs []js.Func
+	listen := func(event string, fn func(ev js.Value)) {
+		f := js.FuncOf(func(this js.Value, p []js.Value) any {
+			fn(p[0])
+			return nil
+		})
+		funcs = append(funcs, f)
+		req.Call("addEventListener", event, f)
 	}
 
-	autoIncrement := false
-	for _, f := range fields {
-		if f.IsAutoInc() {
-			autoIncrement = true
-			break
+	listen("error", func(js.Value) {
+		done <- storeError(req.Get("error"), "", fmt.Err("error open", d.dbName))
+	})
+
+	listen("success", func(js.Value) {
+		if abandoned {
+			req.Get("result").Call("close")
+			return
 		}
-	}
+		d.db = req.Get("result")
+		d.watchVersionChange()
+		done <- nil
+	})
+
+	listen("upgradeneeded", func(js.Value) {
+		if abandoned {
+			req.Get("transaction").Call("abort")
+			return
+		}
+		// The connection is already usable inside the versionchange
+		// transaction, the only place stores and indexes can be altered.
+		d.db = req.Get("result")
+		d.reconcile(req.Get("transaction"), d.version > 0)
+	})
+
+	listen("blocked", d.onBlocked)
 
-	opts := map[string]interface{}{"keyPath": pkName}
-	if autoIncrement {
-		opts["autoIncrement"] = true
+	var timeout <-chan time.Time
+	if d.timeout > 0 {
+		timeout = time.After(d.timeout)
 	}
-	newStore := d.db.Call("createObjectStore", tableName, opts)
 
-	for _, f := range fields {
-		if f.Name == pkName {
-			continue
+	select {
+	case err := <-done:
+		for _, f := range funcs {
+			f.Release()
 		}
-		newStore.Call("createIndex", f.Name, f.Name, map[string]interface{}{"unique": f.IsUnique()})
+		return err
+	case <-timeout:
+		// The callbacks stay registered to clean up a late outcome.
+		abandoned = true
+		d.db = js.Value{}
+		return fmt.Err("opening", d.dbName, "timed out after", d.timeout.String())
 	}
-	return nil
 }
 
 // tableExist checks if a table exists in the database
@@ -0,0 +1,490 @@
+//go:build wasm
+
+package indexdb
+
+import (
+	"sort"
+	"syscall/js"
+
+	"github.com/tinywasm/fmt"
+	. "github.com/tinywasm/model"
+	"github.com/tinywasm/storage"
+)
+
+// Aggregate is one aggregate column: Func applied to Field. Build it with
+// Count, Sum, Avg, Min or Max.
+type Aggregate struct {
+	Func  string // "COUNT", "SUM", "AVG", "MIN" or "MAX"
+	Field string // "*" counts rows
+}
+
+// Count counts the rows with a non-null field, or every row for "*".
+func Count(field string) Aggregate { return Aggregate{Func: "COUNT", Field: field} }
+
+// Sum adds up the numeric values of field.
+func Sum(field string) Aggregate { return Aggregate{Func: "SUM", Field: field} }
+
+// Avg averages the numeric values of field.
+func Avg(field string) Aggregate { return Aggregate{Func: "AVG", Field: field} }
+
+// Min returns the smallest non-null value of field.
+func Min(field string) Aggregate { return Aggregate{Func: "MIN", Field: field} }
+
+// Max returns the largest non-null value of field.
+func Max(field string) Aggregate { return Aggregate{Func: "MAX", Field: field} }
+
+// Column is the name the aggregate has in the result, e.g. "SUM(Price)".
+func (a Aggregate) Column() string { return a.Func + "(" + a.Field + ")" }
+
+// Aggregator computes aggregates without materializing models. The
+// connection returned by New implements it; type-assert the storage.Conn to
+// use it.
+//
+// Aggregate reads q.Table, q.Conditions and q.GroupBy. The rows hold the
+// GroupBy columns followed by one column per aggregate; they come sorted by
+// the GroupBy columns unless q.OrderBy names result columns, and q.Limit and
+// q.Offset page them. Without GroupBy there is exactly one row. As in SQL,
+// nulls are skipped, and SUM, AVG, MIN and MAX of no value are null.
+//
+// An unfiltered COUNT(*), or one whose conditions a key range or IN lookups
+// fully cover, runs as store.count or index.count. MIN and MAX of an indexed
+// text or number column read a single key from a key cursor. Everything
+// else is computed in one pass over the matching records.
+type Aggregator interface {
+	Aggregate(q storage.Query, aggs ...Aggregate) (storage.Rows, error)
+}
+
+// Aggregate implements Aggregator.
+func (d *adapter) Aggregate(q storage.Query, aggs ...Aggregate) (storage.Rows, error) {
+	if len(aggs) == 0 {
+		return nil, fmt.Err("no aggregates passed")
+	}
+	s := d.spec(q.Table)
+	if s == nil {
+		return nil, fmt.Err("table", q.Table, "is not declared")
+	}
+	for _, a := range aggs {
+		switch a.Func {
+		case "COUNT", "SUM", "AVG", "MIN", "MAX":
+		default:
+			return nil, fmt.Err("unknown aggregate", a.Func)
+		}
+		if a.Func == "COUNT" && a.Field == "*" {
+			continue
+		}
+		if _, ok := s.field(a.Field); !ok {
+			return nil, fmt.Err("field", a.Field, "not in schema of", s.name)
+		}
+	}
+	for _, col := range q.GroupBy {
+		if _, ok := s.field(col); !ok {
+			return nil, fmt.Err("field", col, "not in schema of", s.name)
+		}
+	}
+
+	q, err := d.packQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	store, err := d.getStore(nil, q.Table, "readonly")
+	if err != nil {
+		return nil, err
+	}
+	p := planQuery(store, s, q.Conditions)
+
+	var groups []*aggGroup
+	if len(q.GroupBy) == 0 {
+		row, ok, err := d.aggregateKeys(store, s, q, p, aggs)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return aggRows(q, aggs, []js.Value{row}), nil
+		}
+	}
+	if groups, err = d.aggregateScan(store, s, q, p, aggs); err != nil {
+		return nil, err
+	}
+	if len(groups) == 0 && len(q.GroupBy) == 0 {
+		groups = append(groups, newAggGroup(nil, len(aggs)))
+	}
+
+	out := make([]js.Value, len(groups))
+	for i, g := range groups {
+		out[i] = g.row(q.GroupBy, aggs)
+	}
+	return aggRows(q, aggs, out), nil
+}
+
+// aggregateKeys answers every aggregate from counts and single key reads,
+// reporting false when one of them needs the records.
+func (d *adapter) aggregateKeys(store js.Value, s *storeSpec, q storage.Query, p plan, aggs []Aggregate) (js.Value, bool, error) {
+	// The plan has to cover the conditions on its own.
+	indexNames := store.Get("indexNames")
+	filtered := len(q.Conditions) > 0
+	if filtered && (len(p.branches) > 0 || !rangeCovers(s, indexNames, p)) {
+		return js.Value{}, false, nil
+	}
+	for _, a := range aggs {
+		switch a.Func {
+		case "COUNT":
+			if a.Field != "*" {
+				return js.Value{}, false, nil
+			}
+		case "MIN", "MAX":
+			if !keyOrdered(s, a.Field) || d.transformed(s, a.Field) {
+				return js.Value{}, false, nil
+			}
+			source, _, ok := columnSource(s, indexNames, a.Field)
+			if !ok || (filtered && (source != p.index || len(p.keys) > 0)) {
+				return js.Value{}, false, nil
+			}
+		default:
+			return js.Value{}, false, nil
+		}
+	}
+
+	row := js.Global().Get("Object").New()
+	for _, a := range aggs {
+		var v js.Value
+		var err error
+		if a.Func == "COUNT" {
+			v, err = p.count(store, q.Table)
+		} else {
+			source, _, _ := columnSource(s, indexNames, a.Field)
+			v, err = edgeKey(store, source, p.keyRange, a.Func == "MAX")
+		}
+		if err != nil {
+			return js.Value{}, false, err
+		}
+		row.Set(a.Column(), v)
+	}
+	return row, true, nil
+}
+
+// rangeCovers reports whether the key range of p matches exactly the records
+// its residual conditions accept. Range predicates stay residual because an
+// index mixes key types, but on a text or number column every key has the
+// column's type, so a range built from at most one lower and one upper bound
+// of that type needs no further check.
+func rangeCovers(s *storeSpec, indexNames js.Value, p plan) bool {
+	if len(p.residual) == 0 {
+		return true
+	}
+	if !p.keyRange.Truthy() {
+		return false
+	}
+	lower, upper := 0, 0
+	for _, c := range p.residual {
+		source, _, ok := columnSource(s, indexNames, c.Field())
+		if !ok || source != p.index || !keyOrdered(s, c.Field()) {
+			return false
+		}
+		if low, high, ok := betweenOf(c); ok {
+			if !sameKind(s, c.Field(), low) || !sameKind(s, c.Field(), high) {
+				return false
+			}
+			lower++
+			upper++
+			continue
+		}
+		if !sameKind(s, c.Field(), c.Value()) {
+			return false
+		}
+		switch c.Operator() {
+		case ">", ">=":
+			lower++
+		case "<", "<=":
+			upper++
+		default:
+			return false
+		}
+	}
+	return lower <= 1 && upper <= 1
+}
+
+// sameKind reports whether v has the kind the keys of col have.
+func sameKind(s *storeSpec, col string, v any) bool {
+	f, _ := s.field(col)
+	switch v.(type) {
+	case string:
+		return f.Type.Storage() == FieldText
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return f.Type.Storage() == FieldInt || f.Type.Storage() == FieldFloat
+	}
+	return false
+}
+
+// count counts the records the plan reads with count requests, one per
+// lookup key.
+func (p plan) count(store js.Value, table string) (js.Value, error) {
+	source := store
+	if p.index != "" {
+		source = store.Call("index", p.index)
+	}
+	if len(p.keys) == 0 {
+		return awaitRequest(source.Call("count", p.keyRange), table)
+	}
+	reqs := make([]js.Value, len(p.keys))
+	for i, k := range p.keys {
+		reqs[i] = source.Call("count", k)
+	}
+	total := 0
+	for _, r := range reqs {
+		n, err := awaitRequest(r, table)
+		if err != nil {
+			return js.Value{}, err
+		}
+		total += n.Int()
+	}
+	return js.ValueOf(total), nil
+}
+
+// edgeKey reads the lowest key of source within keyRange, or the highest when
+// last is set, with a single key cursor step. Records whose value is null are
+// missing from an index, so they are skipped as MIN and MAX skip nulls.
+func edgeKey(store js.Value, source string, keyRange js.Value, last bool) (js.Value, error) {
+	src := store
+	if source != "" {
+		src = store.Call("index", source)
+	}
+	direction := "next"
+	if last {
+		direction = "prev"
+	}
+	key := js.Null()
+	err := processCursorRequest(src.Call("openKeyCursor", keyRange, direction), func(cursor js.Value) bool {
+		key = cursor.Get("key")
+		return false
+	})
+	return key, err
+}
+
+// aggregateScan computes the aggregates of every group in one pass over the
+// matching records. Records are folded in as the cursor delivers them unless
+// a field they need has to be decrypted or decompressed first, which cannot
+// happen inside a cursor callback.
+func (d *adapter) aggregateScan(store js.Value, s *storeSpec, q storage.Query, p plan, aggs []Aggregate) ([]*aggGroup, error) {
+	unpack := false
+	for _, col := range q.GroupBy {
+		unpack = unpack || d.transformed(s, col)
+	}
+	for _, a := range aggs {
+		unpack = unpack || d.transformed(s, a.Field)
+	}
+
+	var groups []*aggGroup
+	byKey := make(map[string]*aggGroup)
+	add := func(val js.Value) {
+		key := make([]any, len(q.GroupBy))
+		for i, col := range q.GroupBy {
+			key[i] = val.Get(col)
+		}
+		id := stringifyJS(portable(js.ValueOf(key)))
+		g := byKey[id]
+		if g == nil {
+			g = newAggGroup(key, len(aggs))
+			byKey[id] = g
+			groups = append(groups, g)
+		}
+		g.add(val, aggs)
+	}
+
+	var pending []js.Value
+	err := p.walk(store, func(val, pk js.Value) bool {
+		if !checkConditions(val, p.residual) {
+			return true
+		}
+		if unpack {
+			pending = append(pending, val)
+		} else {
+			add(val)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, val := range pending {
+		if err := d.unpackRecord(q.Table, val); err != nil {
+			return nil, err
+		}
+		add(val)
+	}
+	return groups, nil
+}
+
+// aggGroup accumulates the aggregates of one group.
+type aggGroup struct {
+	key   []any // js.Value of each GroupBy column
+	state []aggState
+}
+
+type aggState struct {
+	count int64
+	sum   float64
+	edge  js.Value // MIN or MAX so far; undefined until a value is seen
+}
+
+func newAggGroup(key []any, n int) *aggGroup {
+	return &aggGroup{key: key, state: make([]aggState, n)}
+}
+
+func (g *aggGroup) add(val js.Value, aggs []Aggregate) {
+	for i, a := range aggs {
+		st := &g.state[i]
+		if a.Field == "*" {
+			st.count++
+			continue
+		}
+		v := val.Get(a.Field)
+		if v.IsNull() || v.IsUndefined() {
+			continue
+		}
+		switch a.Func {
+		case "COUNT":
+			st.count++
+		case "SUM", "AVG":
+			if v.Type() == js.TypeNumber {
+				st.count++
+				st.sum += v.Float()
+			}
+		case "MIN", "MAX":
+			if st.edge.IsUndefined() {
+				st.edge = v
+				continue
+			}
+			c := compareJS(v, st.edge)
+			if (a.Func == "MIN" && c < 0) || (a.Func == "MAX" && c > 0) {
+				st.edge = v
+			}
+		}
+	}
+}
+
+// row builds the result record of the group.
+func (g *aggGroup) row(groupBy []string, aggs []Aggregate) js.Value {
+	row := js.Global().Get("Object").New()
+	for i, col := range groupBy {
+		row.Set(col, g.key[i])
+	}
+	for i, a := range aggs {
+		st := g.state[i]
+		v := js.Null()
+		switch a.Func {
+		case "COUNT":
+			v = js.ValueOf(st.count)
+		case "SUM":
+			if st.count > 0 {
+				v = js.ValueOf(st.sum)
+			}
+		case "AVG":
+			if st.count > 0 {
+				v = js.ValueOf(st.sum / float64(st.count))
+			}
+		case "MIN", "MAX":
+			if !st.edge.IsUndefined() {
+				v = st.edge
+			}
+		}
+		row.Set(a.Column(), v)
+	}
+	return row
+}
+
+// aggRows orders and pages the result records of an aggregate query.
+func aggRows(q storage.Query, aggs []Aggregate, rows []js.Value) storage.Rows {
+	fields := make([]Field, 0, len(q.GroupBy)+len(aggs))
+	for _, col := range q.GroupBy {
+		fields = append(fields, Field{Name: col})
+	}
+	for _, a := range aggs {
+		fields = append(fields, Field{Name: a.Column()})
+	}
+
+	order := q.OrderBy
+	if len(order) == 0 {
+		for _, col := range q.GroupBy {
+			order = append(order, storage.Asc(col))
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, o := range order {
+			c := compareJS(rows[i].Get(o.Column()), rows[j].Get(o.Column()))
+			if c != 0 {
+				return (c < 0) != (o.Dir() == "DESC")
+			}
+		}
+		return false
+	})
+
+	start := q.Offset
+	if start < 0 {
+		start = 0
+	}
+	if start > len(rows) {
+		start = len(rows)
+	}
+	end := len(rows)
+	if q.Limit > 0 && start+q.Limit < end {
+		end = start + q.Limit
+	}
+	return &simpleRows{values: rows[start:end], fields: fields}
+}
+
+// compareJS orders two stored values: nulls first, then booleans, numbers
+// and dates (by timestamp), and strings, each compared by value.
+func compareJS(a, b js.Value) int {
+	a, b = sortable(a), sortable(b)
+	ra, rb := jsRank(a), jsRank(b)
+	if ra != rb {
+		if ra < rb {
+			return -1
+		}
+		return 1
+	}
+	switch a.Type() {
+	case js.TypeBoolean:
+		x, y := a.Bool(), b.Bool()
+		if x == y {
+			return 0
+		}
+		if !x {
+			return -1
+		}
+		return 1
+	case js.TypeNumber:
+		x, y := a.Float(), b.Float()
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	case js.TypeString:
+		x, y := a.String(), b.String()
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
+
+func jsRank(v js.Value) int {
+	switch v.Type() {
+	case js.TypeBoolean:
+		return 1
+	case js.TypeNumber:
+		return 2
+	case js.TypeString:
+		return 3
+	case js.TypeObject:
+		return 4
+	}
+	return 0
+}
+
+var _ Aggregator = (*adapter)(nil)
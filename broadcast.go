@@ -0,0 +1,89 @@
+//go:build wasm
+
+package indexdb
+
+import (
+	"syscall/js"
+
+	"github.com/tinywasm/jsvalue"
+	"github.com/tinywasm/storage"
+)
+
+// Changes are posted on a BroadcastChannel named after the database, so the
+// adapters of the same app open in other tabs deliver them to their own
+// subscriptions and watched queries. BroadcastChannel never echoes a message
+// back to the channel that sent it.
+
+// changeMessage tags the messages the adapter posts, since the app may use a
+// channel with the same name for its own purposes.
+const changeMessage = "indexdb.change"
+
+// openChannel joins the database's channel when the browser supports it.
+func (d *adapter) openChannel() {
+	ctor := js.Global().Get("BroadcastChannel")
+	if !ctor.Truthy() {
+		return
+	}
+	d.channel = ctor.New(d.dbName)
+	d.onMessage = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if c, ok := decodeChange(args[0].Get("data")); ok {
+			d.deliver(c)
+		}
+		return nil
+	})
+	d.channel.Call("addEventListener", "message", d.onMessage)
+}
+
+// closeChannel leaves the channel and frees its callback.
+func (d *adapter) closeChannel() {
+	if !d.channel.Truthy() {
+		return
+	}
+	d.channel.Call("close")
+	d.channel = js.Value{}
+	d.onMessage.Release()
+}
+
+// broadcast posts a local change to the other tabs.
+func (d *adapter) broadcast(c Change) {
+	if !d.channel.Truthy() {
+		return
+	}
+	msg := map[string]any{
+		"type":   changeMessage,
+		"table":  c.Table,
+		"action": int(c.Action),
+		"key":    jsvalue.ToJS(c.Key),
+	}
+	if c.Old.Truthy() {
+		msg["old"] = c.Old
+	}
+	if c.New.Truthy() {
+		msg["new"] = c.New
+	}
+	if c.Replaced {
+		msg["replaced"] = true
+	}
+	d.channel.Call("postMessage", msg)
+}
+
+// decodeChange rebuilds a Change posted by another tab.
+func decodeChange(data js.Value) (Change, bool) {
+	if data.Type() != js.TypeObject || data.Get("type").String() != changeMessage {
+		return Change{}, false
+	}
+	c := Change{
+		Table:    data.Get("table").String(),
+		Action:   storage.Action(data.Get("action").Int()),
+		Key:      goKey(data.Get("key")),
+		Remote:   true,
+		Replaced: data.Get("replaced").Truthy(),
+	}
+	if v := data.Get("old"); !v.IsUndefined() {
+		c.Old = v
+	}
+	if v := data.Get("new"); !v.IsUndefined() {
+		c.New = v
+	}
+	return c, true
+}
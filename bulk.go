@@ -0,0 +1,232 @@
+//go:build wasm
+
+package indexdb
+
+import (
+	"syscall/js"
+
+	"github.com/tinywasm/fmt"
+	. "github.com/tinywasm/model"
+	"github.com/tinywasm/storage"
+)
+
+// BulkWriter loads many records in one readwrite transaction. The connection
+// returned by New implements it; type-assert the storage.Conn to use it.
+//
+// Every add/put is issued without waiting for the previous one. A rejected
+// row (e.g. a unique constraint violation) does not abort the others: the
+// call returns a *BulkError listing the failed rows once the transaction
+// has committed the rest. Each stored row is published as a Change, with
+// UpsertAll reporting ActionUpdate.
+type BulkWriter interface {
+	// CreateAll inserts models, failing rows whose primary key already exists.
+	CreateAll(models []Model) error
+	// UpsertAll inserts models or replaces the records with the same key.
+	UpsertAll(models []Model) error
+}
+
+// RowError is one row rejected by a bulk write.
+type RowError struct {
+	Index int // position in the slice passed to the bulk call
+	Table string
+	Err   error
+}
+
+func (e RowError) Error() string {
+	return fmt.Sprintf("row %d (%s): %s", e.Index, e.Table, e.Err.Error())
+}
+
+// Unwrap returns the row's error, typically a *StoreError.
+func (e RowError) Unwrap() error { return e.Err }
+
+// BulkError reports the rows a bulk write rejected.
+type BulkError struct {
+	Failures []RowError
+}
+
+func (e *BulkError) Error() string {
+	msg := fmt.Sprintf("bulk write: %d rows failed", len(e.Failures))
+	if len(e.Failures) > 0 {
+		msg += "; first: " + e.Failures[0].Error()
+	}
+	return msg
+}
+
+// rowProp tags each request with its row index so a single shared error
+// handler can tell which row failed.
+const rowProp = "__indexdbRow"
+
+// CreateAll implements BulkWriter.
+func (d *adapter) CreateAll(models []Model) error {
+	return d.bulkWrite("add", models)
+}
+
+// UpsertAll implements BulkWriter.
+func (d *adapter) UpsertAll(models []Model) error {
+	return d.bulkWrite("put", models)
+}
+
+func (d *adapter) bulkWrite(method string, models []Model) error {
+	if len(models) == 0 {
+		return nil
+	}
+	if err := d.ready(); err != nil {
+		return err
+	}
+
+	storeNames := d.db.Get("objectStoreNames")
+	var scope []any
+	for _, m := range models {
+		name := m.ModelName()
+		if !domStringListHas(storeNames, name) {
+			return fmt.Err("Object store", name, "not found")
+		}
+		if !containsAny(scope, name) {
+			scope = append(scope, name)
+		}
+	}
+
+	// Records are built up front: compressing and encrypting fields await
+	// promises, and the transaction would commit while they wait.
+	var failures []RowError
+	records := make([]js.Value, len(models))
+	for i, m := range models {
+		data, err := d.bulkRecord(m)
+		if err != nil {
+			failures = append(failures, RowError{Index: i, Table: m.ModelName(), Err: err})
+			continue
+		}
+		records[i] = js.ValueOf(data)
+	}
+
+	tx := d.db.Call("transaction", scope, "readwrite")
+
+	action := storage.ActionCreate
+	if method == "put" {
+		action = storage.ActionUpdate
+	}
+	changes := make([]*Change, len(models))
+	onSuccess := js.FuncOf(func(this js.Value, args []js.Value) any {
+		req := args[0].Get("target")
+		i := req.Get(rowProp).Int()
+		changes[i].Key = goKey(req.Get("result"))
+		return nil
+	})
+	defer onSuccess.Release()
+
+	onError := js.FuncOf(func(this js.Value, args []js.Value) any {
+		ev := args[0]
+		req := ev.Get("target")
+		// Keep the transaction alive for the remaining rows.
+		ev.Call("preventDefault")
+		ev.Call("stopPropagation")
+
+		i := req.Get(rowProp).Int()
+		table := models[i].ModelName()
+		failures = append(failures, RowError{Index: i, Table: table, Err: storeError(req.Get("error"), table, fmt.Err("Unknown IndexedDB error"))})
+		return nil
+	})
+	defer onError.Release()
+
+	done := make(chan error, 1)
+	onComplete := js.FuncOf(func(this js.Value, args []js.Value) any {
+		done <- nil
+		return nil
+	})
+	defer onComplete.Release()
+	onAbort := js.FuncOf(func(this js.Value, args []js.Value) any {
+		done <- storeError(tx.Get("error"), "", ErrAborted)
+		return nil
+	})
+	defer onAbort.Release()
+
+	tx.Call("addEventListener", "complete", onComplete)
+	tx.Call("addEventListener", "abort", onAbort)
+
+	for i, m := range models {
+		rec := records[i]
+		if !rec.Truthy() {
+			continue
+		}
+		name := m.ModelName()
+		req := tx.Call("objectStore", name).Call(method, rec)
+		req.Set(rowProp, i)
+		req.Call("addEventListener", "success", onSuccess)
+		req.Call("addEventListener", "error", onError)
+
+		changes[i] = &Change{Table: name, Action: action}
+		if d.observed(name) {
+			changes[i].New = rec
+		}
+	}
+
+	if err := <-done; err != nil {
+		return err
+	}
+	for _, c := range changes {
+		if c != nil && c.Key != nil {
+			d.publish(*c)
+		}
+	}
+	if len(failures) > 0 {
+		for _, f := range failures {
+			if e, ok := isConstraint(f.Err); ok {
+				d.explainConstraint(e, records[f.Index], method == "add")
+			}
+		}
+		return &BulkError{Failures: failures}
+	}
+	return nil
+}
+
+// bulkRecord reads m into a record. An empty text primary key is filled
+// from the ID generator and written back to m; a zero auto-increment key is
+// left out so IndexedDB assigns it. Rows still lacking a valid key are
+// rejected here, since add/put would throw synchronously on them.
+func (d *adapter) bulkRecord(m Model) (map[string]any, error) {
+	fields := m.Schema()
+	ptrs := m.Pointers()
+	values := ReadValues(fields, ptrs)
+
+	data := make(map[string]any, len(fields))
+	for i, f := range fields {
+		v := values[i]
+		if v == nil {
+			if nv, ok := nullableValue(ptrs[i]); ok {
+				v = nv
+			}
+		}
+		if f.IsPK() {
+			if f.IsAutoInc() && IsZeroPtr(ptrs[i], f.Type.Storage()) {
+				continue
+			}
+			if s, ok := v.(string); ok && s == "" {
+				if id := d.getNewID(); id != "" {
+					if p, ok := ptrs[i].(*string); ok {
+						*p = id
+					}
+					v = id
+				}
+			}
+			if _, ok := keyValue(v); !ok || v == "" {
+				return nil, fmt.Err("missing primary key", f.Name)
+			}
+		}
+		data[f.Name] = encodeValue(v)
+	}
+	if err := d.packRecord(m.ModelName(), data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func containsAny(list []any, v any) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+var _ BulkWriter = (*adapter)(nil)
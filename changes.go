@@ -0,0 +1,139 @@
+//go:build wasm
+
+package indexdb
+
+import (
+	"syscall/js"
+
+	"github.com/tinywasm/jsvalue"
+	. "github.com/tinywasm/model"
+	"github.com/tinywasm/storage"
+)
+
+// Change describes one record written through the adapter, or with Replaced
+// a whole table rewritten at once by Import: its Action is ActionUpdate, Key
+// is nil and anything cached from the table must be reloaded.
+type Change struct {
+	Table    string
+	Action   storage.Action // ActionCreate, ActionUpdate or ActionDelete
+	Key      any            // primary key; an []any for a composite key
+	Old      js.Value       // stored record before the write, undefined when not read
+	New      js.Value       // stored record after the write, undefined on delete
+	Remote   bool           // made by another tab on the same database
+	Replaced bool           // every record of Table was replaced
+}
+
+// Notifier delivers change events for writes made through the adapter. The
+// connection returned by New implements it; type-assert the storage.Conn to
+// use it.
+//
+// Changes made inside a transaction are delivered once it commits and
+// dropped if it rolls back. Writes made in other tabs of the same app are
+// delivered too, flagged Remote. Old and New are only filled in while the
+// writing tab has a subscription on the table.
+type Notifier interface {
+	// Subscribe calls fn for every change to table, or to any table when
+	// table is empty. The returned function cancels the subscription.
+	Subscribe(table string, fn func(Change)) (cancel func())
+	// Watch runs q right away and again after writes to q.Table, passing the
+	// fresh rows to fn. Changes arriving together trigger a single re-run.
+	Watch(q storage.Query, m Model, fn func(rows storage.Rows, err error)) (cancel func())
+}
+
+type subscription struct {
+	table string
+	fn    func(Change)
+}
+
+// Subscribe implements Notifier.
+func (d *adapter) Subscribe(table string, fn func(Change)) func() {
+	s := &subscription{table: table, fn: fn}
+	d.subs = append(d.subs, s)
+	return func() { d.unsubscribe(s) }
+}
+
+func (d *adapter) unsubscribe(s *subscription) {
+	for i, x := range d.subs {
+		if x == s {
+			d.subs = append(d.subs[:i], d.subs[i+1:]...)
+			return
+		}
+	}
+}
+
+// Watch implements Notifier. Queries run on their own goroutine so the
+// writer that triggered them is never held up.
+func (d *adapter) Watch(q storage.Query, m Model, fn func(storage.Rows, error)) func() {
+	cancelled, pending := false, false
+	rerun := func() {
+		if pending {
+			return
+		}
+		pending = true
+		go func() {
+			pending = false
+			if cancelled {
+				return
+			}
+			fn(d.Query("", q, m))
+		}()
+	}
+
+	cancel := d.Subscribe(q.Table, func(Change) { rerun() })
+	rerun()
+	return func() {
+		cancelled = true
+		cancel()
+	}
+}
+
+// observed reports whether any subscription covers table.
+func (d *adapter) observed(table string) bool {
+	for _, s := range d.subs {
+		if s.table == "" || s.table == table {
+			return true
+		}
+	}
+	return false
+}
+
+// record publishes c, or holds it until t commits.
+func (d *adapter) record(t *transaction, c Change) {
+	if t != nil {
+		t.changes = append(t.changes, c)
+		return
+	}
+	d.publish(c)
+}
+
+// publish delivers local changes to the matching subscriptions and to the
+// other tabs.
+func (d *adapter) publish(changes ...Change) {
+	for _, c := range changes {
+		d.deliver(c)
+		d.broadcast(c)
+	}
+}
+
+// deliver calls the subscriptions matching c.
+func (d *adapter) deliver(c Change) {
+	// Copy: a callback may cancel its own subscription.
+	subs := append([]*subscription(nil), d.subs...)
+	for _, s := range subs {
+		if s.table == "" || s.table == c.Table {
+			s.fn(c)
+		}
+	}
+}
+
+// goKey converts a primary key read from IndexedDB into a Go value.
+func goKey(key js.Value) any {
+	return jsvalue.ToAny(key)
+}
+
+// snapshot copies a stored record before it is modified in place.
+func snapshot(val js.Value) js.Value {
+	return js.Global().Call("structuredClone", val)
+}
+
+var _ Notifier = (*adapter)(nil)
@@ -0,0 +1,470 @@
+//go:build wasm
+
+package indexdb
+
+import (
+	"syscall/js"
+	"time"
+
+	"github.com/tinywasm/fmt"
+	"github.com/tinywasm/jsvalue"
+	. "github.com/tinywasm/model"
+	"github.com/tinywasm/storage"
+)
+
+// Records are stored as plain JS objects using the structured-clone types
+// IndexedDB keeps natively, so every field type round-trips without loss:
+//
+//	[]byte          Uint8Array
+//	time.Time       Date (millisecond precision, sortable and a valid key)
+//	[]int           Array of numbers
+//	Fielder         nested object, field by field
+//	FielderSlice    Array of nested objects
+//	RawJSON         the JSON text as a string
+//
+// Scalars keep their jsvalue conversion.
+
+var (
+	jsDate        = js.Global().Get("Date")
+	jsUint8Array  = js.Global().Get("Uint8Array")
+	jsArrayBuffer = js.Global().Get("ArrayBuffer")
+)
+
+// encodeValue converts a Go value into the JS value stored in a record.
+func encodeValue(v any) js.Value {
+	switch x := v.(type) {
+	case nil:
+		return js.Null()
+	case js.Value:
+		return x
+	case []byte:
+		return bytesToJS(x)
+	case *[]byte:
+		if x == nil {
+			return js.Null()
+		}
+		return bytesToJS(*x)
+	case time.Time:
+		return dateOf(x)
+	case *time.Time:
+		if x == nil {
+			return js.Null()
+		}
+		return dateOf(*x)
+	case *string:
+		if x == nil {
+			return js.Null()
+		}
+		return js.ValueOf(*x)
+	case *int:
+		if x == nil {
+			return js.Null()
+		}
+		return js.ValueOf(*x)
+	case *int64:
+		if x == nil {
+			return js.Null()
+		}
+		return js.ValueOf(float64(*x))
+	case *float64:
+		if x == nil {
+			return js.Null()
+		}
+		return js.ValueOf(*x)
+	case *bool:
+		if x == nil {
+			return js.Null()
+		}
+		return js.ValueOf(*x)
+	case FielderSlice:
+		if IsNil(x) {
+			return js.Null()
+		}
+		arr := js.Global().Get("Array").New(x.Len())
+		for i := 0; i < x.Len(); i++ {
+			arr.SetIndex(i, encodeFielder(x.At(i)))
+		}
+		return arr
+	case Fielder:
+		return encodeFielder(x)
+	}
+	return jsvalue.ToJS(v)
+}
+
+// encodeFielder stores a nested struct as an object keyed by field name.
+func encodeFielder(f Fielder) js.Value {
+	if f == nil || IsNil(f) {
+		return js.Null()
+	}
+	fields := f.Schema()
+	values := ReadValues(fields, f.Pointers())
+	obj := js.Global().Get("Object").New()
+	for i, field := range fields {
+		obj.Set(field.Name, encodeValue(values[i]))
+	}
+	return obj
+}
+
+func bytesToJS(b []byte) js.Value {
+	arr := jsUint8Array.New(len(b))
+	js.CopyBytesToJS(arr, b)
+	return arr
+}
+
+func dateOf(t time.Time) js.Value {
+	return jsDate.New(float64(t.UnixMilli()))
+}
+
+// dateMillis returns the epoch milliseconds of a JS Date.
+func dateMillis(v js.Value) (float64, bool) {
+	if v.Type() != js.TypeObject || !v.InstanceOf(jsDate) {
+		return 0, false
+	}
+	return v.Call("getTime").Float(), true
+}
+
+// nullableValue reads a nullable field through its pointer-to-pointer
+// destination, which ReadValues does not follow. ok is false for any other
+// destination.
+func nullableValue(ptr any) (v any, ok bool) {
+	switch p := ptr.(type) {
+	case **string:
+		return *p, true
+	case **int:
+		return *p, true
+	case **int64:
+		return *p, true
+	case **float64:
+		return *p, true
+	case **bool:
+		return *p, true
+	case **time.Time:
+		return *p, true
+	}
+	return nil, false
+}
+
+// isNullValue reports whether the Go value v is stored as null.
+func isNullValue(v any) bool {
+	switch x := v.(type) {
+	case nil:
+		return true
+	case *string:
+		return x == nil
+	case *int:
+		return x == nil
+	case *int64:
+		return x == nil
+	case *float64:
+		return x == nil
+	case *bool:
+		return x == nil
+	case *time.Time:
+		return x == nil
+	case *[]byte:
+		return x == nil
+	}
+	return IsNil(v)
+}
+
+// decodeValue copies a stored JS value into the Go pointer dest. A null or
+// missing value is NULL: pointer destinations (**T) are set to nil and value
+// destinations to their zero value.
+func decodeValue(v js.Value, dest any) error {
+	if v.IsNull() || v.IsUndefined() {
+		setNull(dest)
+		return nil
+	}
+	switch p := dest.(type) {
+	case **string:
+		return decodeNew(v, p)
+	case **int:
+		return decodeNew(v, p)
+	case **int64:
+		return decodeNew(v, p)
+	case **float64:
+		return decodeNew(v, p)
+	case **bool:
+		return decodeNew(v, p)
+	case **time.Time:
+		return decodeNew(v, p)
+	case *time.Time:
+		ms, ok := dateMillis(v)
+		if !ok && v.Type() == js.TypeNumber {
+			ms, ok = v.Float(), true
+		}
+		if ok {
+			*p = time.UnixMilli(int64(ms))
+		}
+		return nil
+	case *[]int:
+		n := v.Length()
+		out := make([]int, n)
+		for i := 0; i < n; i++ {
+			out[i] = v.Index(i).Int()
+		}
+		*p = out
+		return nil
+	case FielderSlice:
+		// Elements are appended to the destination slice.
+		for i := 0; i < v.Length(); i++ {
+			if err := decodeFielder(v.Index(i), p.Append()); err != nil {
+				return err
+			}
+		}
+		return nil
+	case Fielder:
+		return decodeFielder(v, p)
+	}
+	return jsvalue.ScanValue(v, dest)
+}
+
+// decodeNew decodes v into a fresh value and points *p at it.
+func decodeNew[T any](v js.Value, p **T) error {
+	x := new(T)
+	if err := decodeValue(v, x); err != nil {
+		return err
+	}
+	*p = x
+	return nil
+}
+
+// setNull stores NULL into dest. Nested structs and destinations of other
+// types are left untouched.
+func setNull(dest any) {
+	switch p := dest.(type) {
+	case *string:
+		*p = ""
+	case *int:
+		*p = 0
+	case *int32:
+		*p = 0
+	case *int64:
+		*p = 0
+	case *uint:
+		*p = 0
+	case *uint32:
+		*p = 0
+	case *uint64:
+		*p = 0
+	case *float32:
+		*p = 0
+	case *float64:
+		*p = 0
+	case *bool:
+		*p = false
+	case *time.Time:
+		*p = time.Time{}
+	case *[]byte:
+		*p = nil
+	case *[]int:
+		*p = nil
+	case *any:
+		*p = nil
+	case **string:
+		*p = nil
+	case **int:
+		*p = nil
+	case **int64:
+		*p = nil
+	case **float64:
+		*p = nil
+	case **bool:
+		*p = nil
+	case **time.Time:
+		*p = nil
+	}
+}
+
+// decodeFielder reads a nested object written by encodeFielder.
+func decodeFielder(v js.Value, f Fielder) error {
+	return scanRecord(v, f.Schema(), f.Pointers())
+}
+
+// scanRecord decodes the fields of a stored record into dest, one pointer per
+// field. Fields missing from the record scan as NULL.
+func scanRecord(val js.Value, fields []Field, dest []any) error {
+	for i, field := range fields {
+		if err := decodeValue(val.Get(field.Name), dest[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Fields declared through Compressor and Encrypter are transformed on their
+// way to disk: the stored value above is compressed, then encrypted. Reads
+// undo both before decoding.
+
+// transformed reports whether col of s is compressed or encrypted.
+func (d *adapter) transformed(s *storeSpec, col string) bool {
+	if _, ok := s.encryption(col); ok {
+		return true
+	}
+	_, ok := d.fieldCodec(s.name, col)
+	return ok
+}
+
+// packValue converts the stored value v of col into its form on disk.
+func (d *adapter) packValue(s *storeSpec, col string, v js.Value) (js.Value, error) {
+	if _, ok := s.compression(col); ok {
+		codec, _ := d.fieldCodec(s.name, col)
+		var err error
+		if v, err = compressValue(codec, v); err != nil {
+			return js.Value{}, err
+		}
+	}
+	if e, ok := s.encryption(col); ok {
+		if d.cipher == nil {
+			return js.Value{}, errNoKey(s.name)
+		}
+		return d.cipher.seal(s.name+"."+col, v, e.Deterministic)
+	}
+	return v, nil
+}
+
+// unpackValue reverses packValue.
+func (d *adapter) unpackValue(s *storeSpec, col string, v js.Value) (js.Value, error) {
+	if _, ok := s.encryption(col); ok && v.Type() == js.TypeString {
+		if d.cipher == nil {
+			return js.Value{}, errNoKey(s.name)
+		}
+		var err error
+		if v, err = d.cipher.open(s.name+"."+col, v); err != nil {
+			return js.Value{}, err
+		}
+	}
+	if codec, ok := d.fieldCodec(s.name, col); ok {
+		return decompressValue(codec, v)
+	}
+	return v, nil
+}
+
+// packQuery transforms the values q writes and the values its conditions
+// compare with. Compressed fields cannot be filtered on.
+func (d *adapter) packQuery(q storage.Query) (storage.Query, error) {
+	s := d.spec(q.Table)
+	if s == nil || (len(s.encrypted) == 0 && len(d.codecs[s.name]) == 0) {
+		return q, nil
+	}
+
+	if len(q.Values) > 0 {
+		values := append([]any(nil), q.Values...)
+		for i, col := range q.Columns {
+			if i >= len(values) || !d.transformed(s, col) {
+				continue
+			}
+			v, err := d.packValue(s, col, encodeValue(values[i]))
+			if err != nil {
+				return q, err
+			}
+			values[i] = v
+		}
+		q.Values = values
+	}
+
+	if len(q.Conditions) > 0 {
+		conds := make([]storage.Condition, 0, len(q.Conditions))
+		for _, cond := range q.Conditions {
+			if sub, ok := groupOf(cond); ok {
+				if err := d.checkGroup(s, sub); err != nil {
+					return q, err
+				}
+				conds = append(conds, cond)
+				continue
+			}
+			if test, _ := nullTest(cond); test {
+				conds = append(conds, cond)
+				continue
+			}
+			if _, ok := s.compression(cond.Field()); ok {
+				return q, fmt.Err("field", s.name+"."+cond.Field(), "is compressed and cannot be filtered on")
+			}
+			e, ok := s.encryption(cond.Field())
+			if !ok {
+				conds = append(conds, cond)
+				continue
+			}
+			if d.cipher == nil {
+				return q, errNoKey(s.name)
+			}
+			sealed, err := d.cipher.sealCondition(s.name, e, cond)
+			if err != nil {
+				return q, err
+			}
+			conds = append(conds, sealed...)
+		}
+		q.Conditions = conds
+	}
+	return q, nil
+}
+
+// checkGroup rejects the conditions of a group on compressed or encrypted
+// fields: a group is carried as it is, so their values cannot be sealed.
+func (d *adapter) checkGroup(s *storeSpec, conds []storage.Condition) error {
+	for _, cond := range leafConditions(conds) {
+		if test, _ := nullTest(cond); test {
+			continue
+		}
+		if _, ok := s.compression(cond.Field()); ok {
+			return fmt.Err("field", s.name+"."+cond.Field(), "is compressed and cannot be filtered on")
+		}
+		if _, ok := s.encryption(cond.Field()); ok {
+			return fmt.Err("field", s.name+"."+cond.Field(), "is encrypted and cannot be filtered inside a group")
+		}
+	}
+	return nil
+}
+
+// packRecord transforms the fields of a record built for table.
+func (d *adapter) packRecord(table string, data map[string]any) error {
+	s := d.spec(table)
+	if s == nil {
+		return nil
+	}
+	for col, v := range data {
+		if !d.transformed(s, col) {
+			continue
+		}
+		packed, err := d.packValue(s, col, encodeValue(v))
+		if err != nil {
+			return err
+		}
+		data[col] = packed
+	}
+	return nil
+}
+
+// unpackRecord restores the transformed fields of a record read from table,
+// in place. The record is a copy made by IndexedDB, never the stored one.
+// It awaits WebCrypto and stream promises, so it must not run inside a
+// cursor callback.
+func (d *adapter) unpackRecord(table string, val js.Value) error {
+	s := d.spec(table)
+	if s == nil {
+		return nil
+	}
+	return d.unpackFields(s, val, s.fields)
+}
+
+// unpackFields is unpackRecord restricted to fields, for projected reads.
+func (d *adapter) unpackFields(s *storeSpec, val js.Value, fields []Field) error {
+	if s == nil || val.Type() != js.TypeObject {
+		return nil
+	}
+	for _, f := range fields {
+		if !d.transformed(s, f.Name) {
+			continue
+		}
+		v := val.Get(f.Name)
+		if v.IsUndefined() || v.IsNull() {
+			continue
+		}
+		plain, err := d.unpackValue(s, f.Name, v)
+		if err != nil {
+			return err
+		}
+		val.Set(f.Name, plain)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+//go:build wasm
+
+package indexdb
+
+import (
+	"syscall/js"
+
+	"github.com/tinywasm/fmt"
+	"github.com/tinywasm/jsvalue"
+)
+
+// Compressed fields are stored as the Uint8Array output of a
+// CompressionStream; a field holding a string was written uncompressed.
+//
+// The codec of every compressed field is recorded in the metaStore record of
+// its table the first time the field is seen, and that codec is used from
+// then on: changing the declared Codec has no effect on a recorded field, and
+// a field no longer declared compressed keeps decoding its old values while
+// new writes store plain text.
+
+// metaStore is the internal object store holding one record per table: the
+// database version that last declared it and the codecs of its fields.
+//
+//	{store: "posts", version: 3, codecs: {"Body": "gzip"}}
+const metaStore = internalStorePrefix + "indexdb_meta"
+
+// needsMeta reports whether any declared table compresses a field.
+func (d *adapter) needsMeta() bool {
+	for _, s := range d.specs {
+		if len(s.compressed) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// loadCodecs reads the recorded codecs and records the ones of newly
+// compressed fields. It runs once the database is open.
+func (d *adapter) loadCodecs() error {
+	d.codecs = make(map[string]map[string]Codec)
+	if !domStringListHas(d.db.Get("objectStoreNames"), metaStore) {
+		if d.needsMeta() {
+			d.logger("store", metaStore, "is missing in", d.dbName, "- bump Version to record field codecs")
+			for _, s := range d.specs {
+				d.declareCodecs(s)
+			}
+		}
+		return nil
+	}
+
+	store := d.db.Call("transaction", metaStore, "readwrite").Call("objectStore", metaStore)
+	all, err := awaitRequest(store.Call("getAll"), metaStore)
+	if err != nil {
+		return err
+	}
+	records := make(map[string]js.Value)
+	for i := 0; i < all.Length(); i++ {
+		rec := all.Index(i)
+		records[rec.Get("store").String()] = rec
+		codecs := rec.Get("codecs")
+		if codecs.Type() != js.TypeObject {
+			continue
+		}
+		fields := make(map[string]Codec)
+		keys := js.Global().Get("Object").Call("keys", codecs)
+		for j := 0; j < keys.Length(); j++ {
+			name := keys.Index(j).String()
+			fields[name] = Codec(codecs.Get(name).String())
+		}
+		d.codecs[rec.Get("store").String()] = fields
+	}
+
+	var pending bool
+	for _, s := range d.specs {
+		if !d.declareCodecs(s) {
+			continue
+		}
+		codecs := make(map[string]any)
+		for name, c := range d.codecs[s.name] {
+			codecs[name] = string(c)
+		}
+		rec, ok := records[s.name]
+		if !ok {
+			rec = js.Global().Get("Object").New()
+			rec.Set("store", s.name)
+		}
+		rec.Set("codecs", codecs)
+		store.Call("put", rec)
+		pending = true
+	}
+	if !pending {
+		return nil
+	}
+	return awaitTx(store.Get("transaction"), metaStore)
+}
+
+// declareCodecs adds the compressed fields of s missing from d.codecs and
+// reports whether it added any. A field recorded with another codec keeps it.
+func (d *adapter) declareCodecs(s *storeSpec) bool {
+	fields := d.codecs[s.name]
+	if fields == nil {
+		fields = make(map[string]Codec)
+		d.codecs[s.name] = fields
+	}
+	added := false
+	for _, c := range s.compressed {
+		recorded, ok := fields[c.Name]
+		if !ok {
+			fields[c.Name] = c.Codec
+			added = true
+			continue
+		}
+		if recorded != c.Codec {
+			d.logger("field", c.Name, "of", s.name, "stays compressed with", string(recorded), "as recorded, not", string(c.Codec))
+		}
+	}
+	return added
+}
+
+// fieldCodec returns the codec the values of table.col were written with.
+func (d *adapter) fieldCodec(table, col string) (Codec, bool) {
+	c, ok := d.codecs[table][col]
+	return c, ok
+}
+
+// compressValue compresses the stored string v.
+func compressValue(codec Codec, v js.Value) (js.Value, error) {
+	if v.Type() != js.TypeString {
+		return v, nil
+	}
+	return pipeStream(v, js.Global().Get("CompressionStream"), codec)
+}
+
+// decompressValue reverses compressValue; values stored as plain text are
+// returned as they are.
+func decompressValue(codec Codec, v js.Value) (js.Value, error) {
+	if v.Type() != js.TypeObject || !v.InstanceOf(jsUint8Array) {
+		return v, nil
+	}
+	out, err := pipeStream(v, js.Global().Get("DecompressionStream"), codec)
+	if err != nil {
+		return js.Value{}, err
+	}
+	return js.ValueOf(string(bufferBytes(out))), nil
+}
+
+// pipeStream runs data through a (De)CompressionStream and returns the
+// output bytes as a Uint8Array.
+func pipeStream(data, transform js.Value, codec Codec) (js.Value, error) {
+	if !transform.Truthy() {
+		return js.Value{}, fmt.Err("CompressionStream not available")
+	}
+	blob := js.Global().Get("Blob").New([]any{data})
+	stream := blob.Call("stream").Call("pipeThrough", transform.New(string(codec)))
+	buf, err := jsvalue.AwaitPromise(js.Global().Get("Response").New(stream).Call("arrayBuffer"))
+	if err != nil {
+		return js.Value{}, err
+	}
+	return jsUint8Array.New(buf), nil
+}
@@ -0,0 +1,71 @@
+//go:build wasm
+
+package indexdb
+
+import "github.com/tinywasm/storage"
+
+// Conditions with the operators "BETWEEN" and "NOT IN" are evaluated and
+// planned natively:
+//
+//	BETWEEN  value is a two-item list, low and high, both included. On an
+//	         indexed column it reads a single key range.
+//	NOT IN   value is a list.
+//
+// storage v0.0.2 has no constructors for them, so callers cannot build them
+// yet; they are expected as storage.Between(field, low, high) and
+// storage.NotIn(field, list) once storage exports those.
+
+// betweenOf returns the bounds of a BETWEEN condition.
+func betweenOf(c storage.Condition) (low, high any, ok bool) {
+	if c.Operator() != "BETWEEN" {
+		return nil, nil, false
+	}
+	items, ok := listValues(c.Value())
+	if !ok || len(items) != 2 {
+		return nil, nil, false
+	}
+	return items[0], items[1], true
+}
+
+// A condition with the operator "GROUP" is a parenthesized expression: its
+// value is the []storage.Condition inside, combined like the conditions of a
+// query, and its Logic joins the group to the conditions around it:
+//
+//	Group(A, Or(B)), C  reads  (A OR B) AND C
+//
+// storage v0.0.2 has no constructor for it, so callers cannot build one
+// yet; it is expected as storage.Group(conds ...storage.Condition) once
+// storage exports that.
+
+// groupOf returns the conditions of a GROUP condition.
+func groupOf(c storage.Condition) ([]storage.Condition, bool) {
+	if c.Operator() != "GROUP" {
+		return nil, false
+	}
+	conds, ok := c.Value().([]storage.Condition)
+	return conds, ok
+}
+
+// hasGroup reports whether any of conds is a group.
+func hasGroup(conds []storage.Condition) bool {
+	for _, c := range conds {
+		if _, ok := groupOf(c); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// leafConditions lists conds with every group replaced by the conditions
+// inside it, recursively.
+func leafConditions(conds []storage.Condition) []storage.Condition {
+	var out []storage.Condition
+	for _, c := range conds {
+		if sub, ok := groupOf(c); ok {
+			out = append(out, leafConditions(sub)...)
+			continue
+		}
+		out = append(out, c)
+	}
+	return out
+}
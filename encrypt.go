@@ -0,0 +1,239 @@
+//go:build wasm
+
+package indexdb
+
+import (
+	"encoding/base64"
+	"syscall/js"
+	"time"
+
+	"github.com/tinywasm/fmt"
+	"github.com/tinywasm/jsvalue"
+	"github.com/tinywasm/storage"
+)
+
+// Encrypted fields are stored as the base64 text of a 12-byte IV followed by
+// the AES-GCM ciphertext of the field's JSON encoding (tagged as in exports).
+// The "table.field" name is bound to the ciphertext as additional data, so a
+// value copied into another field fails to decrypt. Null values are stored
+// as null.
+//
+// Randomized fields draw a fresh IV for every write. Deterministic fields
+// derive it from an HMAC of the name and value, so equal values encrypt
+// alike and equality filters can run on the ciphertext.
+
+const ivSize = 12
+
+// fieldCipher holds the keys derived from the EncryptionKey.
+type fieldCipher struct {
+	subtle js.Value
+	aesKey js.Value
+	macKey js.Value
+}
+
+// newFieldCipher derives the AES-GCM and HMAC keys from secret with HKDF.
+func newFieldCipher(secret []byte) (*fieldCipher, error) {
+	if len(secret) < 16 {
+		return nil, fmt.Err("encryption key must be at least 16 bytes")
+	}
+	crypto := js.Global().Get("crypto")
+	if !crypto.Truthy() || !crypto.Get("subtle").Truthy() {
+		return nil, fmt.Err("crypto.subtle not available")
+	}
+	c := &fieldCipher{subtle: crypto.Get("subtle")}
+
+	base, err := jsvalue.AwaitPromise(c.subtle.Call("importKey", "raw", bytesToJS(secret), "HKDF", false, []any{"deriveKey"}))
+	if err != nil {
+		return nil, err
+	}
+	derive := func(info string, alg map[string]any, usages ...any) (js.Value, error) {
+		params := map[string]any{
+			"name": "HKDF",
+			"hash": "SHA-256",
+			"salt": bytesToJS(nil),
+			"info": bytesToJS([]byte(info)),
+		}
+		return jsvalue.AwaitPromise(c.subtle.Call("deriveKey", params, base, alg, false, usages))
+	}
+
+	if c.aesKey, err = derive("indexdb aes-gcm", map[string]any{"name": "AES-GCM", "length": 256}, "encrypt", "decrypt"); err != nil {
+		return nil, err
+	}
+	if c.macKey, err = derive("indexdb hmac-iv", map[string]any{"name": "HMAC", "hash": "SHA-256"}, "sign"); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// seal encrypts the stored value v of the field named by aad.
+func (c *fieldCipher) seal(aad string, v js.Value, deterministic bool) (js.Value, error) {
+	if v.IsNull() || v.IsUndefined() {
+		return v, nil
+	}
+	plain := []byte(stringifyJS(portable(v)))
+
+	var iv []byte
+	if deterministic {
+		mac, err := jsvalue.AwaitPromise(c.subtle.Call("sign", "HMAC", c.macKey, bytesToJS(append([]byte(aad+"\x00"), plain...))))
+		if err != nil {
+			return js.Value{}, err
+		}
+		iv = bufferBytes(mac)[:ivSize]
+	} else {
+		iv = bufferBytes(js.Global().Get("crypto").Call("getRandomValues", jsUint8Array.New(ivSize)))
+	}
+
+	params := map[string]any{"name": "AES-GCM", "iv": bytesToJS(iv), "additionalData": bytesToJS([]byte(aad))}
+	ct, err := jsvalue.AwaitPromise(c.subtle.Call("encrypt", params, c.aesKey, bytesToJS(plain)))
+	if err != nil {
+		return js.Value{}, err
+	}
+	return js.ValueOf(base64.StdEncoding.EncodeToString(append(iv, bufferBytes(ct)...))), nil
+}
+
+// open reverses seal.
+func (c *fieldCipher) open(aad string, v js.Value) (js.Value, error) {
+	if v.Type() != js.TypeString {
+		return v, nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(v.String())
+	if err != nil || len(raw) < ivSize {
+		return js.Value{}, fmt.Err("field", aad, "does not hold an encrypted value")
+	}
+
+	params := map[string]any{"name": "AES-GCM", "iv": bytesToJS(raw[:ivSize]), "additionalData": bytesToJS([]byte(aad))}
+	plain, err := jsvalue.AwaitPromise(c.subtle.Call("decrypt", params, c.aesKey, bytesToJS(raw[ivSize:])))
+	if err != nil {
+		return js.Value{}, fmt.Err("decrypting field", aad, "failed:", err)
+	}
+	parsed, err := parseJSON(string(bufferBytes(plain)))
+	if err != nil {
+		return js.Value{}, err
+	}
+	return restore(parsed), nil
+}
+
+// bufferBytes copies an ArrayBuffer or Uint8Array into Go.
+func bufferBytes(buf js.Value) []byte {
+	arr := buf
+	if !arr.InstanceOf(jsUint8Array) {
+		arr = jsUint8Array.New(buf)
+	}
+	b := make([]byte, arr.Length())
+	js.CopyBytesToGo(b, arr)
+	return b
+}
+
+// sealCondition encrypts the value of a condition on the encrypted field e.
+// Conditions on randomized fields, and anything but =, !=, IN and NOT IN on
+// deterministic ones, are rejected since they cannot be evaluated on
+// ciphertext.
+//
+// storage has no constructor for NOT IN, so a sealed NOT IN is returned as
+// one != per item; the first keeps the condition's logic and the rest join it
+// with AND, which reads the same under AND-over-OR precedence.
+func (c *fieldCipher) sealCondition(table string, e EncryptedField, cond storage.Condition) ([]storage.Condition, error) {
+	aad := table + "." + e.Name
+	// Nulls are stored as null, so NULL tests work on any encrypted field.
+	if test, _ := nullTest(cond); test {
+		return []storage.Condition{cond}, nil
+	}
+	if !e.Deterministic {
+		return nil, fmt.Err("field", aad, "is encrypted and cannot be filtered on; declare it Deterministic to allow =, !=, IN and NOT IN")
+	}
+
+	op := cond.Operator()
+	var out []storage.Condition
+	switch op {
+	case "=", "!=":
+		v, err := c.seal(aad, encodeValue(cond.Value()), true)
+		if err != nil {
+			return nil, err
+		}
+		if op == "=" {
+			out = append(out, storage.Eq(cond.Field(), jsvalue.ToAny(v)))
+		} else {
+			out = append(out, storage.Neq(cond.Field(), jsvalue.ToAny(v)))
+		}
+	case "IN", "NOT IN":
+		items, isList := listValues(cond.Value())
+		if !isList {
+			return nil, fmt.Err(op, "on field", aad, "needs a list")
+		}
+		list := make([]any, len(items))
+		for i, item := range items {
+			v, err := c.seal(aad, encodeValue(item), true)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = jsvalue.ToAny(v)
+		}
+		if op == "IN" {
+			out = append(out, storage.In(cond.Field(), list))
+			break
+		}
+		for _, v := range list {
+			out = append(out, storage.Neq(cond.Field(), v))
+		}
+		if len(out) == 0 {
+			// Nothing to exclude: every non-null value matches.
+			out = append(out, storage.IsNotNull(cond.Field()))
+		}
+	default:
+		return nil, fmt.Err("operator", op, "is not supported on encrypted field", aad)
+	}
+
+	if cond.Logic() == "OR" {
+		out[0] = storage.Or(out[0])
+	}
+	return out, nil
+}
+
+// listValues flattens the list forms an IN condition accepts: a slice of
+// any key kind. A []byte is a binary value, not a list.
+func listValues(list any) ([]any, bool) {
+	switch l := list.(type) {
+	case []any:
+		return l, true
+	case []string:
+		return anyList(l), true
+	case []int:
+		return anyList(l), true
+	case []int8:
+		return anyList(l), true
+	case []int16:
+		return anyList(l), true
+	case []int32:
+		return anyList(l), true
+	case []int64:
+		return anyList(l), true
+	case []uint:
+		return anyList(l), true
+	case []uint16:
+		return anyList(l), true
+	case []uint32:
+		return anyList(l), true
+	case []uint64:
+		return anyList(l), true
+	case []float32:
+		return anyList(l), true
+	case []float64:
+		return anyList(l), true
+	case []time.Time:
+		return anyList(l), true
+	}
+	return nil, false
+}
+
+func anyList[T any](l []T) []any {
+	out := make([]any, len(l))
+	for i, v := range l {
+		out[i] = v
+	}
+	return out
+}
+
+// errNoKey reports a table with encrypted fields opened without a key.
+func errNoKey(table string) error {
+	return fmt.Err("table", table, "has encrypted fields but no EncryptionKey was given")
+}
@@ -0,0 +1,148 @@
+//go:build wasm
+
+package indexdb
+
+import (
+	"syscall/js"
+
+	"github.com/tinywasm/await"
+	"github.com/tinywasm/fmt"
+)
+
+// Sentinel errors for the IndexedDB failures callers can act on. Every error
+// the adapter returns for a failed request wraps one of them when the
+// DOMException name is known, so errors.Is matches it.
+var (
+	ErrConstraint          = fmt.Err("constraint", "violation")         // ConstraintError
+	ErrQuotaExceeded       = fmt.Err("storage", "quota", "exceeded")    // QuotaExceededError
+	ErrNotFound            = fmt.Err("object", "store", "not", "found") // NotFoundError
+	ErrVersion             = fmt.Err("version", "mismatch")             // VersionError
+	ErrAborted             = fmt.Err("transaction", "aborted")          // AbortError
+	ErrData                = fmt.Err("invalid", "key", "or", "value")   // DataError
+	ErrTransactionInactive = fmt.Err("transaction", "inactive")         // TransactionInactiveError
+)
+
+// ErrTxExpired is reported by a transaction left open past its TxTimeout,
+// which rolled it back.
+var ErrTxExpired = fmt.Err("transaction", "expired")
+
+var domErrors = map[string]error{
+	"ConstraintError":          ErrConstraint,
+	"QuotaExceededError":       ErrQuotaExceeded,
+	"NotFoundError":            ErrNotFound,
+	"VersionError":             ErrVersion,
+	"AbortError":               ErrAborted,
+	"DataError":                ErrData,
+	"TransactionInactiveError": ErrTransactionInactive,
+}
+
+// StoreError is an IndexedDB DOMException translated by the adapter. It
+// unwraps to the sentinel matching Name, if any.
+type StoreError struct {
+	Name    string // DOMException name, e.g. "ConstraintError"
+	Message string
+	Table   string // object store involved, when known
+	Index   string // unique index that rejected the write; empty for the primary key
+	Value   any    // conflicting key value, when it could be determined
+}
+
+func (e *StoreError) Error() string {
+	msg := e.Name
+	if e.Table != "" {
+		msg += " on " + e.Table
+	}
+	if e.Index != "" {
+		msg += " index " + e.Index
+	}
+	if e.Value != nil {
+		msg += fmt.Sprintf(" value %v", e.Value)
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// Unwrap returns the sentinel error for Name.
+func (e *StoreError) Unwrap() error { return domErrors[e.Name] }
+
+// storeError translates a DOMException (an IDBRequest or IDBTransaction
+// error) into a *StoreError. fallback is returned when there is none.
+func storeError(errVal js.Value, table string, fallback error) error {
+	if !errVal.Truthy() {
+		return fallback
+	}
+	return &StoreError{
+		Name:    errVal.Get("name").String(),
+		Message: errVal.Get("message").String(),
+		Table:   table,
+	}
+}
+
+// awaitRequest waits for req and translates its failure.
+func awaitRequest(req js.Value, table string) (js.Value, error) {
+	res, err := await.Request(req)
+	if err != nil {
+		return res, storeError(req.Get("error"), table, err)
+	}
+	return res, nil
+}
+
+// isConstraint reports whether err is a constraint violation to explain.
+func isConstraint(err error) (*StoreError, bool) {
+	e, ok := err.(*StoreError)
+	return e, ok && e.Name == "ConstraintError"
+}
+
+// explainConstraint finds which key of the rejected record rec collided with a
+// stored record and fills in e.Index and e.Value. The primary key is only
+// checked for adds, since a put replaces the record with the same key. The
+// failed request aborted its transaction, so the lookups use a fresh one.
+func (d *adapter) explainConstraint(e *StoreError, rec js.Value, isAdd bool) {
+	s := d.spec(e.Table)
+	if s == nil || !d.db.Truthy() {
+		return
+	}
+	store := d.db.Call("transaction", e.Table, "readonly").Call("objectStore", e.Table)
+
+	// An auto-increment record rejected on add has no key of its own yet.
+	hasOwn := hasValidKey(rec, s.keyPath)
+	var own js.Value
+	if hasOwn {
+		own = keyOf(rec, s.keyPath)
+	}
+
+	if isAdd && hasOwn {
+		found, err := await.Request(store.Call("getKey", own))
+		if err == nil && !found.IsUndefined() {
+			e.Value = goKey(own)
+			return
+		}
+	}
+
+	for _, idx := range s.indexes {
+		if !idx.unique || !hasValidKey(rec, idx.keyPath) {
+			continue
+		}
+		key := keyOf(rec, idx.keyPath)
+		found, err := await.Request(store.Call("index", idx.name).Call("getKey", key))
+		if err != nil || found.IsUndefined() || (hasOwn && jsCompare(found, own) == 0) {
+			continue
+		}
+		e.Index, e.Value = idx.name, goKey(key)
+		return
+	}
+}
+
+// keyOf reads the key for path from rec: a scalar for a single field, an
+// array for several.
+func keyOf(rec js.Value, path []string) js.Value {
+	if len(path) == 1 {
+		return rec.Get(path[0])
+	}
+	arr := js.Global().Get("Array").New(len(path))
+	for i, p := range path {
+		arr.SetIndex(i, rec.Get(p))
+	}
+	return arr
+}
@@ -5,9 +5,7 @@ package indexdb
 import (
 	"sort"
 	"syscall/js"
-
-	"github.com/tinywasm/await"
-	"github.com/tinywasm/jsvalue"
+	"time"
 
 	"github.com/tinywasm/fmt"
 	. "github.com/tinywasm/model"
@@ -15,26 +13,31 @@ import (
 )
 
 // execute implements storage.Adapter for IndexDB.
-func (d *adapter) execute(q storage.Query, m Model, factory func() Model, each func(Model), eachJS func(js.Value)) error {
+// t scopes the action to an explicit transaction; nil gives it its own.
+func (d *adapter) execute(t *transaction, q storage.Query, m Model, factory func() Model, each func(Model), eachJS func(js.Value)) error {
+	q, err := d.packQuery(q)
+	if err != nil {
+		return err
+	}
 	switch q.Action {
 	case storage.ActionCreate:
-		return d.create(q, m)
+		return d.create(t, q, m)
 	case storage.ActionUpdate:
-		return d.update(q, m)
+		return d.update(t, q, m)
 	case storage.ActionDelete:
-		return d.delete(q, m)
+		return d.delete(t, q, m)
 	case storage.ActionReadOne:
-		return d.readOne(q, m)
+		return d.readOne(t, q, m)
 	case storage.ActionReadAll:
-		return d.readAll(q, factory, each, eachJS)
+		return d.readAll(t, q, m, factory, each, eachJS)
 	default:
 		return fmt.Err("Action not implemented")
 	}
 }
 
-func (d *adapter) create(q storage.Query, m Model) error {
+func (d *adapter) create(t *transaction, q storage.Query, m Model) error {
 	// Establish a "readwrite" transaction block directed at the store mapped via q.Table.
-	store, err := d.getStore(q.Table, "readwrite")
+	store, err := d.getStore(t, q.Table, "readwrite")
 	if err != nil {
 		return err
 	}
@@ -42,35 +45,56 @@ func (d *adapter) create(q storage.Query, m Model) error {
 	// Iterate structurally mapping q.Columns and q.Values onto a conventional JavaScript Map Object
 	data := make(map[string]any)
 	for i, col := range q.Columns {
-		data[col] = q.Values[i]
+		data[col] = encodeValue(q.Values[i])
 	}
 
 	// Deploy store.add() and explicitly await its resolution event.
-	req := store.Call("add", data)
-	_, err = await.Request(req)
-	return err
+	rec := js.ValueOf(data)
+	req := store.Call("add", rec)
+	key, err := awaitRequest(req, q.Table)
+	if err != nil {
+		if e, ok := isConstraint(err); ok {
+			d.explainConstraint(e, rec, true)
+		}
+		return err
+	}
+
+	c := Change{Table: q.Table, Action: storage.ActionCreate, Key: goKey(key)}
+	if d.observed(q.Table) {
+		c.New = rec
+	}
+	return d.committed(t, store, q.Table, c)
+}
+
+// committed records the changes of a write. Without an explicit transaction
+// the write's own transaction is awaited first, so failures raised only at
+// commit time, such as QuotaExceededError, are reported and changes are
+// published once durable.
+func (d *adapter) committed(t *transaction, store js.Value, table string, changes ...Change) error {
+	if t == nil {
+		if err := awaitTx(store.Get("transaction"), table); err != nil {
+			return err
+		}
+	}
+	for _, c := range changes {
+		d.record(t, c)
+	}
+	return nil
 }
 
-func (d *adapter) update(q storage.Query, m Model) error {
-	store, err := d.getStore(q.Table, "readwrite")
+func (d *adapter) update(t *transaction, q storage.Query, m Model) error {
+	store, err := d.getStore(t, q.Table, "readwrite")
 	if err != nil {
 		return err
 	}
 
 	fields := m.Schema()
-	pkName := ""
-	for _, f := range fields {
-		if f.IsPK() {
-			pkName = f.Name
-			break
-		}
-	}
+	pks := primaryKeyFields(fields)
 
-	// Optimize: single PK equality condition (handles updates with direct get and put)
-	if len(q.Conditions) == 1 && q.Conditions[0].Operator() == "=" && q.Conditions[0].Field() == pkName {
-		pkValue := q.Conditions[0].Value()
+	// Optimize: equality on every PK column (handles updates with direct get and put)
+	if pkValue, ok := pkLookup(pks, q.Conditions); ok {
 		getReq := store.Call("get", pkValue)
-		val, err := await.Request(getReq)
+		val, err := awaitRequest(getReq, q.Table)
 		if err != nil {
 			return err
 		}
@@ -79,37 +103,11 @@ func (d *adapter) update(q storage.Query, m Model) error {
 			return storage.ErrNoRows
 		}
 
-		// Overwrite fields
-		data := make(map[string]any)
-		for _, f := range fields {
-			jsVal := val.Get(f.Name)
-			if !jsVal.IsUndefined() {
-				switch f.Type.Storage() {
-				case FieldText:
-					data[f.Name] = jsVal.String()
-				case FieldInt:
-					data[f.Name] = int64(jsVal.Int())
-				case FieldFloat:
-					data[f.Name] = jsVal.Float()
-				case FieldBool:
-					data[f.Name] = jsVal.Bool()
-				}
-			}
-		}
-
-		for i, col := range q.Columns {
-			if col == pkName {
-				newVal := q.Values[i]
-				if newVal == "" || newVal == nil || newVal == int(0) || newVal == int64(0) || newVal == float64(0) {
-					continue
-				}
-			}
-			data[col] = q.Values[i]
+		c, err := d.putUpdated(store, val, q, pks)
+		if err != nil {
+			return err
 		}
-
-		putReq := store.Call("put", data)
-		_, err = await.Request(putReq)
-		return err
+		return d.committed(t, store, q.Table, c)
 	}
 
 	// For cursors, collect all matching records first to avoid nested AwaitRequest deadlocks
@@ -118,10 +116,9 @@ func (d *adapter) update(q storage.Query, m Model) error {
 	}
 	var matched []matchRecord
 
-	req := store.Call("openCursor")
-	err = processCursorRequest(req, func(cursor js.Value) bool {
-		val := cursor.Get("value")
-		if checkConditions(val, q.Conditions) {
+	p := planQuery(store, d.spec(q.Table), q.Conditions)
+	err = p.walk(store, func(val, pk js.Value) bool {
+		if checkConditions(val, p.residual) {
 			matched = append(matched, matchRecord{val: val})
 		}
 		return true
@@ -130,116 +127,146 @@ func (d *adapter) update(q storage.Query, m Model) error {
 		return err
 	}
 
+	changes := make([]Change, 0, len(matched))
 	for _, item := range matched {
-		data := make(map[string]any)
-		for _, f := range fields {
-			jsVal := item.val.Get(f.Name)
-			if !jsVal.IsUndefined() {
-				switch f.Type.Storage() {
-				case FieldText:
-					data[f.Name] = jsVal.String()
-				case FieldInt:
-					data[f.Name] = int64(jsVal.Int())
-				case FieldFloat:
-					data[f.Name] = jsVal.Float()
-				case FieldBool:
-					data[f.Name] = jsVal.Bool()
-				}
-			}
-		}
-
-		for i, col := range q.Columns {
-			if col == pkName {
-				newVal := q.Values[i]
-				if newVal == "" || newVal == nil || newVal == int(0) || newVal == int64(0) || newVal == float64(0) {
-					continue
-				}
-			}
-			data[col] = q.Values[i]
-		}
-
-		putReq := store.Call("put", data)
-		_, err = await.Request(putReq)
+		c, err := d.putUpdated(store, item.val, q, pks)
 		if err != nil {
 			return err
 		}
+		changes = append(changes, c)
 	}
 
-	return nil
+	return d.committed(t, store, q.Table, changes...)
 }
 
-func (d *adapter) delete(q storage.Query, m Model) error {
-	store, err := d.getStore(q.Table, "readwrite")
+// putUpdated applies q to the stored record val and writes it back.
+func (d *adapter) putUpdated(store, val js.Value, q storage.Query, pks []string) (Change, error) {
+	c := Change{Table: q.Table, Action: storage.ActionUpdate}
+	observed := d.observed(q.Table)
+	if observed {
+		c.Old = snapshot(val)
+	}
+
+	key, err := awaitRequest(store.Call("put", applyUpdate(val, q, pks)), q.Table)
 	if err != nil {
-		return err
+		if e, ok := isConstraint(err); ok {
+			d.explainConstraint(e, val, false)
+		}
+		return c, err
 	}
 
-	fields := m.Schema()
-	pkName := ""
-	for _, f := range fields {
-		if f.IsPK() {
-			pkName = f.Name
-			break
+	c.Key = goKey(key)
+	if observed {
+		c.New = val
+	}
+	return c, nil
+}
+
+// applyUpdate writes the updated columns into the stored record in place, so
+// fields the query does not touch keep their stored value whatever their type.
+// Zero values for primary key columns are ignored.
+func applyUpdate(val js.Value, q storage.Query, pks []string) js.Value {
+	for i, col := range q.Columns {
+		if containsString(pks, col) {
+			newVal := q.Values[i]
+			if newVal == "" || newVal == nil || newVal == int(0) || newVal == int64(0) || newVal == float64(0) {
+				continue
+			}
 		}
+		val.Set(col, encodeValue(q.Values[i]))
 	}
+	return val
+}
 
-	// If it is a simple single equality condition on the PK, we can delete by key directly.
-	if len(q.Conditions) == 1 && q.Conditions[0].Operator() == "=" && q.Conditions[0].Field() == pkName {
-		pkValue := q.Conditions[0].Value()
-		req := store.Call("delete", pkValue)
-		_, err = await.Request(req)
+func (d *adapter) delete(t *transaction, q storage.Query, m Model) error {
+	store, err := d.getStore(t, q.Table, "readwrite")
+	if err != nil {
 		return err
 	}
 
+	fields := m.Schema()
+	pks := primaryKeyFields(fields)
+
+	// If the conditions are equalities on every PK column, we can delete by key directly.
+	// The record is read first so deleting a missing key publishes no change.
+	if pkValue, ok := pkLookup(pks, q.Conditions); ok {
+		old, err := awaitRequest(store.Call("get", pkValue), q.Table)
+		if err != nil {
+			return err
+		}
+		if old.IsUndefined() {
+			return d.committed(t, store, q.Table)
+		}
+		if _, err = awaitRequest(store.Call("delete", pkValue), q.Table); err != nil {
+			return err
+		}
+		c := Change{Table: q.Table, Action: storage.ActionDelete, Key: goKey(js.ValueOf(pkValue))}
+		if d.observed(q.Table) {
+			c.Old = old
+		}
+		return d.committed(t, store, q.Table, c)
+	}
+
 	// Otherwise, find matching records using a cursor and delete them.
-	req := store.Call("openCursor")
+	p := planQuery(store, d.spec(q.Table), q.Conditions)
+	observed := d.observed(q.Table)
 
-	return processCursorRequest(req, func(cursor js.Value) bool {
-		val := cursor.Get("value")
+	var changes []Change
+	err = p.walk(store, func(val, pk js.Value) bool {
 
-		if checkConditions(val, q.Conditions) {
-			cursor.Call("delete")
+		if checkConditions(val, p.residual) {
+			store.Call("delete", pk)
+			c := Change{Table: q.Table, Action: storage.ActionDelete, Key: goKey(pk)}
+			if observed {
+				c.Old = val
+			}
+			changes = append(changes, c)
 		}
 
 		return true
 	})
+	if err != nil {
+		return err
+	}
+	return d.committed(t, store, q.Table, changes...)
 }
 
-func (d *adapter) readOne(q storage.Query, m Model) error {
-	store, err := d.getStore(q.Table, "readonly")
+func (d *adapter) readOne(t *transaction, q storage.Query, m Model) error {
+	store, err := d.getStore(t, q.Table, "readonly")
 	if err != nil {
 		return err
 	}
 
-	// Attempt to get by key if simple condition. We only do this if we are querying the PK.
-	// For simplicity, we'll try `get` first if it's a single equality, and fall back to cursor.
-	if len(q.Conditions) == 1 && q.Conditions[0].Operator() == "=" {
-		key := q.Conditions[0].Value()
-		req := store.Call("get", key)
-		result, err := await.Request(req)
-		if err == nil && result.Truthy() {
-			return mapResult(result, m)
+	s := d.spec(q.Table)
+	fields, idx, err := projection(q, m)
+	if err != nil {
+		return err
+	}
+
+	// Equality on every PK column is a direct lookup.
+	if key, ok := pkLookup(primaryKeyFields(m.Schema()), q.Conditions); ok {
+		result, err := awaitRequest(store.Call("get", key), q.Table)
+		if err != nil {
+			return err
 		}
-		// If not found by key, maybe it wasn't the PK. Fall back to cursor.
+		if !result.Truthy() {
+			return storage.ErrNoRows
+		}
+		if err := d.unpackFields(s, result, fields); err != nil {
+			return err
+		}
+		return mapResult(result, m, idx)
 	}
 
-	// Otherwise, iterate with cursor until first match
-	req := store.Call("openCursor")
-	var found bool
+	// Otherwise iterate the planned cursor until the first match.
+	p := coverPlan(s, planQuery(store, s, q.Conditions), q.Columns)
+	var found js.Value
 
-	err = processCursorRequest(req, func(cursor js.Value) bool {
-		val := cursor.Get("value")
+	err = p.walk(store, func(val, pk js.Value) bool {
 
 		// Check conditions
-		match := checkConditions(val, q.Conditions)
-
-		if match {
-			// Found it
-			err := mapResult(val, m)
-			if err != nil {
-				d.logger("Mapping error:", err)
-			}
-			found = true
+		if checkConditions(val, p.residual) {
+			found = val
 			return false // Stop iteration
 		}
 
@@ -249,9 +276,16 @@ func (d *adapter) readOne(q storage.Query, m Model) error {
 	if err != nil {
 		return err
 	}
-	if !found {
+	if !found.Truthy() {
 		return storage.ErrNoRows
 	}
+	// unpackRecord awaits promises, which cannot happen inside a cursor callback.
+	if err := d.unpackFields(s, found, fields); err != nil {
+		return err
+	}
+	if err := mapResult(found, m, idx); err != nil {
+		d.logger("Mapping error:", err)
+	}
 	return nil
 }
 
@@ -260,32 +294,39 @@ type matchedItem struct {
 	val   js.Value
 }
 
-func (d *adapter) readAll(q storage.Query, factory func() Model, each func(Model), eachJS func(js.Value)) error {
-	store, err := d.getStore(q.Table, "readonly")
+func (d *adapter) readAll(t *transaction, q storage.Query, m Model, factory func() Model, each func(Model), eachJS func(js.Value)) error {
+	store, err := d.getStore(t, q.Table, "readonly")
+	if err != nil {
+		return err
+	}
+	fields, idx, err := projection(q, m)
 	if err != nil {
 		return err
 	}
 
-	req := store.Call("openCursor")
-
-	var matched []matchedItem
+	s := d.spec(q.Table)
+	p := planQuery(store, s, q.Conditions)
+	if op, ok := planOrder(store, s, q, p); ok {
+		return d.readOrdered(store, coverPlan(s, op, q.Columns), q, fields, idx, factory, each, eachJS)
+	}
 
-	err = processCursorRequest(req, func(cursor js.Value) bool {
-		val := cursor.Get("value")
-
-		if checkConditions(val, q.Conditions) {
-			var newItem Model
-			if factory != nil {
-				newItem = factory()
-				if newItem != nil {
-					err := mapResult(val, newItem)
-					if err != nil {
-						d.logger("Mapping error:", err)
-						return true // Continue iteration
-					}
-				}
+	// The in-memory sort reads the order columns as well.
+	cols, read := q.Columns, fields
+	if len(cols) > 0 && s != nil {
+		for _, o := range q.OrderBy {
+			if f, ok := s.field(o.Column()); ok && !containsString(cols, f.Name) {
+				cols = append(append([]string(nil), cols...), f.Name)
+				read = append(append([]Field(nil), read...), f)
 			}
-			matched = append(matched, matchedItem{model: newItem, val: val})
+		}
+	}
+	p = coverPlan(s, p, cols)
+	var vals []js.Value
+
+	err = p.walk(store, func(val, pk js.Value) bool {
+
+		if checkConditions(val, p.residual) {
+			vals = append(vals, val)
 		}
 
 		return true // Continue iteration
@@ -294,44 +335,31 @@ func (d *adapter) readAll(q storage.Query, factory func() Model, each func(Model
 		return err
 	}
 
-	// Apply OrderBy
+	var matched []matchedItem
+	for _, val := range vals {
+		if err := d.unpackFields(s, val, read); err != nil {
+			return err
+		}
+		item, ok := d.newMatch(val, factory, idx)
+		if !ok {
+			continue
+		}
+		matched = append(matched, item)
+	}
+
+	// Apply OrderBy. NULL and missing values sort first, as in SQLite.
 	if len(q.OrderBy) > 0 {
-		sort.Slice(matched, func(i, j int) bool {
+		sort.SliceStable(matched, func(i, j int) bool {
 			for _, order := range q.OrderBy {
 				col := order.Column()
-				jsA := matched[i].val.Get(col)
-				jsB := matched[j].val.Get(col)
-
-				// Compare jsA and jsB
-				switch jsA.Type() {
-				case js.TypeString:
-					strA := jsA.String()
-					strB := jsB.String()
-					if strA != strB {
-						if order.Dir() == "DESC" {
-							return strA > strB
-						}
-						return strA < strB
-					}
-				case js.TypeNumber:
-					numA := jsA.Float()
-					numB := jsB.Float()
-					if numA != numB {
-						if order.Dir() == "DESC" {
-							return numA > numB
-						}
-						return numA < numB
-					}
-				case js.TypeBoolean:
-					boolA := jsA.Bool()
-					boolB := jsB.Bool()
-					if boolA != boolB {
-						if order.Dir() == "DESC" {
-							return boolA && !boolB
-						}
-						return !boolA && boolB
-					}
+				c := compareJS(matched[i].val.Get(col), matched[j].val.Get(col))
+				if c == 0 {
+					continue
+				}
+				if order.Dir() == "DESC" {
+					return c > 0
 				}
+				return c < 0
 			}
 			return false
 		})
@@ -360,7 +388,8 @@ func (d *adapter) readAll(q storage.Query, factory func() Model, each func(Model
 	for _, item := range sliced {
 		if each != nil {
 			each(item.model)
-		} else if eachJS != nil {
+		}
+		if eachJS != nil {
 			eachJS(item.val)
 		}
 	}
@@ -368,55 +397,143 @@ func (d *adapter) readAll(q storage.Query, factory func() Model, each func(Model
 	return nil
 }
 
-// mapResult maps a JS value to a Model's pointers
-func mapResult(val js.Value, m Model) error {
-	fields := m.Schema()
-	ptrs := m.Pointers()
+// sortable compares Dates by their timestamp.
+func sortable(v js.Value) js.Value {
+	if ms, ok := dateMillis(v); ok {
+		return js.ValueOf(ms)
+	}
+	return v
+}
 
-	for i, field := range fields {
-		jsVal := val.Get(field.Name)
-		if jsVal.IsUndefined() {
-			continue
+// readOrdered walks a cursor already in the requested order, applying Offset
+// and Limit on the way so only the requested page is materialized. Without
+// residual conditions the offset is skipped with a single cursor.advance.
+// The page is emitted once the walk ends.
+func (d *adapter) readOrdered(store js.Value, p plan, q storage.Query, fields []Field, idx []int, factory func() Model, each func(Model), eachJS func(js.Value)) error {
+	skip := 0
+	if q.Offset > 0 {
+		skip = q.Offset
+	}
+	advance := 0
+	if len(p.residual) == 0 {
+		advance, skip = skip, 0
+	}
+
+	var page []js.Value
+	req := p.openCursor(store)
+	err := walkCursor(req, advance, func(cursor js.Value) bool {
+		val := p.record(cursor)
+		if !checkConditions(val, p.residual) {
+			return true
 		}
+		if skip > 0 {
+			skip--
+			return true
+		}
+		page = append(page, val)
+		return q.Limit <= 0 || len(page) < q.Limit
+	})
+	if err != nil {
+		return err
+	}
 
-		if err := jsvalue.ScanValue(jsVal, ptrs[i]); err != nil {
+	s := d.spec(q.Table)
+	for _, val := range page {
+		if err := d.unpackFields(s, val, fields); err != nil {
 			return err
 		}
+		item, ok := d.newMatch(val, factory, idx)
+		if !ok {
+			continue
+		}
+		if each != nil {
+			each(item.model)
+		}
+		if eachJS != nil {
+			eachJS(item.val)
+		}
 	}
 	return nil
 }
 
-// checkConditions checks a slice of conditions sequentially
+// newMatch builds the result item for a matched record, mapping it into a
+// fresh model when a factory is given.
+func (d *adapter) newMatch(val js.Value, factory func() Model, idx []int) (matchedItem, bool) {
+	var newItem Model
+	if factory != nil {
+		newItem = factory()
+		if newItem != nil {
+			if err := mapResult(val, newItem, idx); err != nil {
+				d.logger("Mapping error:", err)
+				return matchedItem{}, false
+			}
+		}
+	}
+	return matchedItem{model: newItem, val: val}, true
+}
+
+// mapResult maps a JS value to a Model's pointers, only to those at the
+// schema positions in idx when it is not nil (see projection).
+func mapResult(val js.Value, m Model, idx []int) error {
+	fields, ptrs := m.Schema(), m.Pointers()
+	if idx == nil {
+		return scanRecord(val, fields, ptrs)
+	}
+	picked := make([]Field, len(idx))
+	dest := make([]any, len(idx))
+	for i, j := range idx {
+		picked[i], dest[i] = fields[j], ptrs[j]
+	}
+	return scanRecord(val, picked, dest)
+}
+
+// checkConditions reports whether val satisfies conditions, with AND
+// binding tighter than OR (see orGroups) and groups evaluated recursively.
 func checkConditions(val js.Value, conditions []storage.Condition) bool {
 	if len(conditions) == 0 {
 		return true
 	}
-
-	cond := conditions[0]
-	fieldVal := val.Get(cond.Field())
-	match := checkCondition(fieldVal, cond)
-
-	for i := 1; i < len(conditions); i++ {
-		cond = conditions[i]
-		fieldVal = val.Get(cond.Field())
-		condMatch := checkCondition(fieldVal, cond)
-		if cond.Logic() == "OR" {
-			match = match || condMatch
-		} else {
-			match = match && condMatch
+	for _, group := range orGroups(conditions) {
+		if checkAll(val, group) {
+			return true
 		}
 	}
+	return false
+}
 
-	return match
+// checkAll reports whether val satisfies every condition of an AND chain.
+func checkAll(val js.Value, conditions []storage.Condition) bool {
+	for _, cond := range conditions {
+		if sub, ok := groupOf(cond); ok {
+			if !checkConditions(val, sub) {
+				return false
+			}
+			continue
+		}
+		if !checkCondition(val.Get(cond.Field()), cond) {
+			return false
+		}
+	}
+	return true
 }
 
-// checkCondition checks if a JS value satisfies a condition
+// checkCondition checks if a JS value satisfies a condition. A null or
+// missing value is NULL: it only satisfies IS NULL (or = nil) and, as in
+// SQL, fails every comparison, != included.
 func checkCondition(val js.Value, cond storage.Condition) bool {
-	// Simple type checking and comparison
-	// This needs to be robust for types (string, number, boolean)
+	isNull := val.IsNull() || val.IsUndefined()
+	if test, wantNull := nullTest(cond); test {
+		return isNull == wantNull
+	}
+	if isNull {
+		return false
+	}
 
 	// Get Go value from JS value for comparison
 	var goVal any
+	if ms, ok := dateMillis(val); ok {
+		val = js.ValueOf(ms)
+	}
 	switch val.Type() {
 	case js.TypeString:
 		goVal = val.String()
@@ -429,6 +546,15 @@ func checkCondition(val js.Value, cond storage.Condition) bool {
 	}
 
 	condVal := cond.Value()
+	if t, ok := condVal.(time.Time); ok {
+		condVal = float64(t.UnixMilli())
+	}
+
+	if low, high, ok := betweenOf(cond); ok {
+		lo, okLo := compareOrdered(goVal, low)
+		hi, okHi := compareOrdered(goVal, high)
+		return okLo && okHi && lo >= 0 && hi <= 0
+	}
 
 	switch cond.Operator() {
 	case "=":
@@ -437,186 +563,129 @@ func checkCondition(val js.Value, cond storage.Condition) bool {
 		return !compareAny(goVal, condVal)
 	case "IN":
 		return valueInList(goVal, condVal)
-	case "LIKE":
+	case "NOT IN":
+		return !valueInList(goVal, condVal)
+	case "LIKE", "ILIKE":
 		sVal, okS := goVal.(string)
-		patVal, okP := condVal.(string)
+		pattern, fold, okP := likePattern(condVal)
 		if okS && okP {
-			return matchLike(sVal, patVal)
+			return matchLike(sVal, pattern, fold || cond.Operator() == "ILIKE")
 		}
 		return false
 	case ">":
-		if v1, ok := goVal.(float64); ok {
-			if v2, ok := condVal.(float64); ok {
-				return v1 > v2
-			}
-			if v2, ok := condVal.(int); ok {
-				return v1 > float64(v2)
-			}
-			if v2, ok := condVal.(int64); ok {
-				return v1 > float64(v2)
-			}
-		} else if v1, ok := goVal.(string); ok {
-			if v2, ok := condVal.(string); ok {
-				return v1 > v2
-			}
-		}
+		c, ok := compareOrdered(goVal, condVal)
+		return ok && c > 0
 	case ">=":
-		if v1, ok := goVal.(float64); ok {
-			if v2, ok := condVal.(float64); ok {
-				return v1 >= v2
-			}
-			if v2, ok := condVal.(int); ok {
-				return v1 >= float64(v2)
-			}
-			if v2, ok := condVal.(int64); ok {
-				return v1 >= float64(v2)
-			}
-		} else if v1, ok := goVal.(string); ok {
-			if v2, ok := condVal.(string); ok {
-				return v1 >= v2
-			}
-		}
+		c, ok := compareOrdered(goVal, condVal)
+		return ok && c >= 0
 	case "<":
-		if v1, ok := goVal.(float64); ok {
-			if v2, ok := condVal.(float64); ok {
-				return v1 < v2
-			}
-			if v2, ok := condVal.(int); ok {
-				return v1 < float64(v2)
-			}
-			if v2, ok := condVal.(int64); ok {
-				return v1 < float64(v2)
-			}
-		} else if v1, ok := goVal.(string); ok {
-			if v2, ok := condVal.(string); ok {
-				return v1 < v2
-			}
-		}
+		c, ok := compareOrdered(goVal, condVal)
+		return ok && c < 0
 	case "<=":
-		if v1, ok := goVal.(float64); ok {
-			if v2, ok := condVal.(float64); ok {
-				return v1 <= v2
-			}
-			if v2, ok := condVal.(int); ok {
-				return v1 <= float64(v2)
-			}
-			if v2, ok := condVal.(int64); ok {
-				return v1 <= float64(v2)
-			}
-		} else if v1, ok := goVal.(string); ok {
-			if v2, ok := condVal.(string); ok {
-				return v1 <= v2
-			}
-		}
+		c, ok := compareOrdered(goVal, condVal)
+		return ok && c <= 0
 	}
 
 	return false
 }
 
-func compareAny(a, b any) bool {
-	if a == b {
-		return true
-	}
-	var fA, fB float64
-	var okA, okB bool
-	switch v := a.(type) {
+// compareOrdered compares a stored number or string with a condition value
+// of the same kind, returning -1, 0 or 1. Dates compare as epoch
+// milliseconds. ok is false when the kinds differ.
+func compareOrdered(goVal, condVal any) (int, bool) {
+	switch v1 := goVal.(type) {
 	case float64:
-		fA, okA = v, true
-	case int64:
-		fA, okA = float64(v), true
-	case int:
-		fA, okA = float64(v), true
-	}
-	switch v := b.(type) {
-	case float64:
-		fB, okB = v, true
-	case int64:
-		fB, okB = float64(v), true
-	case int:
-		fB, okB = float64(v), true
-	}
-	if okA && okB {
-		return fA == fB
-	}
-	return false
-}
-
-func valueInList(goVal any, list any) bool {
-	switch l := list.(type) {
-	case []any:
-		for _, item := range l {
-			if compareAny(goVal, item) {
-				return true
-			}
+		v2, ok := numberValue(condVal)
+		if !ok {
+			return 0, false
 		}
-	case []string:
-		for _, item := range l {
-			if compareAny(goVal, item) {
-				return true
-			}
-		}
-	case []int64:
-		for _, item := range l {
-			if compareAny(goVal, item) {
-				return true
-			}
+		switch {
+		case v1 < v2:
+			return -1, true
+		case v1 > v2:
+			return 1, true
 		}
-	case []int:
-		for _, item := range l {
-			if compareAny(goVal, item) {
-				return true
-			}
+		return 0, true
+	case string:
+		v2, ok := condVal.(string)
+		if !ok {
+			return 0, false
 		}
-	case []float64:
-		for _, item := range l {
-			if compareAny(goVal, item) {
-				return true
-			}
+		switch {
+		case v1 < v2:
+			return -1, true
+		case v1 > v2:
+			return 1, true
 		}
+		return 0, true
 	}
-	return false
+	return 0, false
 }
 
-func matchLike(s, pattern string) bool {
-	if len(pattern) == 0 {
-		return s == ""
-	}
-	if pattern == "%" {
-		return true
-	}
-
-	hasPrefixWildcard := pattern[0] == '%'
-	hasSuffixWildcard := pattern[len(pattern)-1] == '%'
-
-	cleanPattern := pattern
-	if hasPrefixWildcard {
-		cleanPattern = cleanPattern[1:]
-	}
-	if hasSuffixWildcard {
-		cleanPattern = cleanPattern[:len(cleanPattern)-1]
-	}
+// numberValue converts a condition value of any numeric kind to the float64
+// a stored number reads as, the way keyValue accepts every kind as a key.
+// Dates convert to epoch milliseconds.
+func numberValue(v any) (float64, bool) {
+	switch x := v.(type) {
+	case float64:
+		return x, true
+	case float32:
+		return float64(x), true
+	case int:
+		return float64(x), true
+	case int8:
+		return float64(x), true
+	case int16:
+		return float64(x), true
+	case int32:
+		return float64(x), true
+	case int64:
+		return float64(x), true
+	case uint:
+		return float64(x), true
+	case uint8:
+		return float64(x), true
+	case uint16:
+		return float64(x), true
+	case uint32:
+		return float64(x), true
+	case uint64:
+		return float64(x), true
+	case time.Time:
+		return float64(x.UnixMilli()), true
+	}
+	return 0, false
+}
 
-	if hasPrefixWildcard && hasSuffixWildcard {
-		return containsSubstring(s, cleanPattern)
-	}
-	if hasPrefixWildcard {
-		return hasSuffix(s, cleanPattern)
-	}
-	if hasSuffixWildcard {
-		return hasPrefix(s, cleanPattern)
+// nullTest reports whether cond tests for NULL, and whether it wants NULL:
+// IS NULL and = nil do, IS NOT NULL and != nil do not.
+func nullTest(cond storage.Condition) (test, wantNull bool) {
+	switch cond.Operator() {
+	case "IS NULL":
+		return true, true
+	case "IS NOT NULL":
+		return true, false
+	case "=", "!=":
+		if isNullValue(cond.Value()) {
+			return true, cond.Operator() == "="
+		}
 	}
-	return s == pattern
+	return false, false
 }
 
-func containsSubstring(s, sub string) bool {
-	if len(sub) == 0 {
+func compareAny(a, b any) bool {
+	if a == b {
 		return true
 	}
-	if len(s) < len(sub) {
-		return false
-	}
-	for i := 0; i <= len(s)-len(sub); i++ {
-		if s[i:i+len(sub)] == sub {
+	fA, okA := numberValue(a)
+	fB, okB := numberValue(b)
+	return okA && okB && fA == fB
+}
+
+func valueInList(goVal any, list any) bool {
+	items, _ := listValues(list)
+	for _, item := range items {
+		if compareAny(goVal, item) {
 			return true
 		}
 	}
@@ -626,7 +695,3 @@ func containsSubstring(s, sub string) bool {
 func hasPrefix(s, prefix string) bool {
 	return len(s) >= len(prefix) && s[:len(prefix)] == prefix
 }
-
-func hasSuffix(s, suffix string) bool {
-	return len(s) >= len(suffix) && s[len(s)-len(suffix):] == suffix
-}
@@ -0,0 +1,422 @@
+//go:build wasm
+
+package indexdb
+
+import (
+	"encoding/base64"
+	"io"
+	"syscall/js"
+
+	"github.com/tinywasm/fmt"
+	"github.com/tinywasm/storage"
+)
+
+// Format selects the layout of an export.
+type Format int
+
+const (
+	// JSON writes a single document:
+	//	{"database":..., "version":..., "stores":[{"store":{...}, "records":[...]}]}
+	JSON Format = iota
+	// NDJSON writes one JSON value per line: a {"store":{...}} line
+	// followed by one {"record":{...}} line per record of that store.
+	NDJSON
+)
+
+// Exporter dumps the declared object stores with their layout and records,
+// and loads such a dump back. The connection returned by New implements it;
+// type-assert the storage.Conn to use it.
+//
+// Records keep the stored field encoding; binary values and dates, which
+// JSON cannot hold, are written as {"$bytes": base64} and {"$date": epoch ms}.
+type Exporter interface {
+	// Export writes every declared store from one consistent snapshot.
+	Export(w io.Writer, format Format) error
+	// Import validates the whole dump against the declared models, then
+	// replaces the contents of every store it contains in one transaction.
+	// Stores missing from the dump are left untouched. Once committed, a
+	// Change with Replaced set is published for every imported store.
+	Import(r io.Reader, format Format) error
+}
+
+var jsJSON = js.Global().Get("JSON")
+
+// Export implements Exporter.
+func (d *adapter) Export(w io.Writer, format Format) error {
+	if err := d.ready(); err != nil {
+		return err
+	}
+
+	storeNames := d.db.Get("objectStoreNames")
+	var specs []*storeSpec
+	var scope []any
+	for _, s := range d.specs {
+		if domStringListHas(storeNames, s.name) {
+			specs = append(specs, s)
+			scope = append(scope, s.name)
+		}
+	}
+	if len(specs) == 0 {
+		return fmt.Err("no object stores to export")
+	}
+
+	ew := &exportWriter{w: w}
+	if format == JSON {
+		ew.printf(`{"database":%s,"version":%d,"stores":[`, quoteJSON(d.dbName), d.db.Get("version").Int())
+	}
+
+	tx := d.db.Call("transaction", scope, "readonly")
+	for i, s := range specs {
+		meta := stringifyJS(specMeta(s))
+		if format == JSON {
+			if i > 0 {
+				ew.printf(",")
+			}
+			ew.printf(`{"store":%s,"records":[`, meta)
+		} else {
+			ew.printf("{\"store\":%s}\n", meta)
+		}
+
+		n := 0
+		req := tx.Call("objectStore", s.name).Call("openCursor")
+		err := processCursorRequest(req, func(cursor js.Value) bool {
+			rec := stringifyJS(portable(cursor.Get("value")))
+			if format == JSON {
+				if n > 0 {
+					ew.printf(",")
+				}
+				ew.printf("%s", rec)
+			} else {
+				ew.printf("{\"record\":%s}\n", rec)
+			}
+			n++
+			return ew.err == nil
+		})
+		if err != nil {
+			return err
+		}
+		if ew.err != nil {
+			return ew.err
+		}
+		if format == JSON {
+			ew.printf("]}")
+		}
+	}
+
+	if format == JSON {
+		ew.printf("]}\n")
+	}
+	return ew.err
+}
+
+// Import implements Exporter.
+func (d *adapter) Import(r io.Reader, format Format) error {
+	if err := d.ready(); err != nil {
+		return err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	dump, err := parseDump(string(data), format)
+	if err != nil {
+		return err
+	}
+	if len(dump) == 0 {
+		return nil
+	}
+
+	var scope []any
+	for _, ds := range dump {
+		if err := d.validateDump(ds); err != nil {
+			return err
+		}
+		scope = append(scope, ds.spec.name)
+	}
+
+	tx := d.db.Call("transaction", scope, "readwrite")
+	changes := make([]Change, len(dump))
+	for i, ds := range dump {
+		store := tx.Call("objectStore", ds.spec.name)
+		store.Call("clear")
+		for _, rec := range ds.records {
+			store.Call("put", rec)
+		}
+		changes[i] = Change{Table: ds.spec.name, Action: storage.ActionUpdate, Replaced: true}
+	}
+	if err := awaitTx(tx, ""); err != nil {
+		return err
+	}
+	d.publish(changes...)
+	return nil
+}
+
+// dumpStore is one store read back from a dump.
+type dumpStore struct {
+	meta    js.Value
+	spec    *storeSpec
+	records []js.Value
+}
+
+// parseDump splits a dump into its stores, restoring tagged values.
+func parseDump(text string, format Format) ([]*dumpStore, error) {
+	var out []*dumpStore
+
+	if format == JSON {
+		doc, err := parseJSON(text)
+		if err != nil {
+			return nil, err
+		}
+		if doc.Type() != js.TypeObject {
+			return nil, fmt.Err("import: missing stores array")
+		}
+		stores := doc.Get("stores")
+		if !stores.Truthy() || !stores.InstanceOf(js.Global().Get("Array")) {
+			return nil, fmt.Err("import: missing stores array")
+		}
+		for i := 0; i < stores.Length(); i++ {
+			entry := stores.Index(i)
+			if entry.Type() != js.TypeObject || entry.Get("store").Type() != js.TypeObject {
+				return nil, fmt.Err("import: stores entry", i, "has no store object")
+			}
+			ds := &dumpStore{meta: entry.Get("store")}
+			recs := entry.Get("records")
+			if recs.Truthy() && !recs.InstanceOf(js.Global().Get("Array")) {
+				return nil, fmt.Err("import: records of stores entry", i, "are not an array")
+			}
+			for j := 0; recs.Truthy() && j < recs.Length(); j++ {
+				ds.records = append(ds.records, restore(recs.Index(j)))
+			}
+			out = append(out, ds)
+		}
+		return out, nil
+	}
+
+	var cur *dumpStore
+	for lineNo, line := range splitLines(text) {
+		if line == "" {
+			continue
+		}
+		v, err := parseJSON(line)
+		if err != nil {
+			return nil, fmt.Err("import: line", lineNo+1, err)
+		}
+		if v.Type() != js.TypeObject {
+			return nil, fmt.Err("import: line", lineNo+1, "is neither a store nor a record")
+		}
+		switch {
+		case !v.Get("store").IsUndefined():
+			if v.Get("store").Type() != js.TypeObject {
+				return nil, fmt.Err("import: line", lineNo+1, "has no store object")
+			}
+			cur = &dumpStore{meta: v.Get("store")}
+			out = append(out, cur)
+		case !v.Get("record").IsUndefined():
+			if cur == nil {
+				return nil, fmt.Err("import: line", lineNo+1, "record before any store")
+			}
+			cur.records = append(cur.records, restore(v.Get("record")))
+		default:
+			return nil, fmt.Err("import: line", lineNo+1, "is neither a store nor a record")
+		}
+	}
+	return out, nil
+}
+
+// validateDump checks a dumped store against the declared model: the store
+// must be declared with the same key, every dumped field must exist with the
+// same type, and every record may only hold schema fields plus a valid key.
+func (d *adapter) validateDump(ds *dumpStore) error {
+	name := ds.meta.Get("name")
+	if name.Type() != js.TypeString {
+		return fmt.Err("import: store without name")
+	}
+	s := d.spec(name.String())
+	if s == nil {
+		return fmt.Err("import: store", name.String(), "is not declared")
+	}
+	ds.spec = s
+
+	if keyPathString(ds.meta.Get("keyPath")) != joinPath(s.keyPath) {
+		return fmt.Err("import: primary key of", s.name, "differs from its schema")
+	}
+
+	fields := ds.meta.Get("fields")
+	if fields.Truthy() && !fields.InstanceOf(js.Global().Get("Array")) {
+		return fmt.Err("import: fields of", s.name, "are not an array")
+	}
+	for i := 0; fields.Truthy() && i < fields.Length(); i++ {
+		fv := fields.Index(i)
+		if fv.Type() != js.TypeObject {
+			return fmt.Err("import: field", i, "of", s.name, "is not an object")
+		}
+		f, ok := s.field(fv.Get("name").String())
+		if !ok {
+			return fmt.Err("import: field", fv.Get("name").String(), "not in schema of", s.name)
+		}
+		if f.Type != nil && fv.Get("type").String() != f.Type.Storage().String() {
+			return fmt.Err("import: field", f.Name, "of", s.name, "changed type")
+		}
+	}
+
+	keys := js.Global().Get("Object")
+	for i, rec := range ds.records {
+		if rec.Type() != js.TypeObject {
+			return fmt.Err("import: record", i, "of", s.name, "is not an object")
+		}
+		props := keys.Call("keys", rec)
+		for j := 0; j < props.Length(); j++ {
+			if _, ok := s.field(props.Index(j).String()); !ok {
+				return fmt.Err("import: record", i, "of", s.name, "has unknown field", props.Index(j).String())
+			}
+		}
+		if !s.acceptsKey(rec) {
+			return fmt.Err("import: record", i, "of", s.name, "has no valid primary key")
+		}
+	}
+	return nil
+}
+
+// specMeta describes a store layout for a dump.
+func specMeta(s *storeSpec) js.Value {
+	indexes := make([]any, len(s.indexes))
+	for i, idx := range s.indexes {
+		indexes[i] = map[string]any{
+			"name":    idx.name,
+			"keyPath": stringsToAny(idx.keyPath),
+			"unique":  idx.unique,
+		}
+	}
+	fields := make([]any, len(s.fields))
+	for i, f := range s.fields {
+		typ := ""
+		if f.Type != nil {
+			typ = f.Type.Storage().String()
+		}
+		fields[i] = map[string]any{"name": f.Name, "type": typ}
+	}
+	return js.ValueOf(map[string]any{
+		"name":          s.name,
+		"keyPath":       stringsToAny(s.keyPath),
+		"autoIncrement": s.autoInc,
+		"indexes":       indexes,
+		"fields":        fields,
+	})
+}
+
+func stringsToAny(list []string) []any {
+	out := make([]any, len(list))
+	for i, v := range list {
+		out[i] = v
+	}
+	return out
+}
+
+// portable rewrites the values JSON cannot hold into tagged objects.
+func portable(v js.Value) js.Value {
+	if v.Type() != js.TypeObject {
+		return v
+	}
+	if ms, ok := dateMillis(v); ok {
+		return js.ValueOf(map[string]any{"$date": ms})
+	}
+	if v.InstanceOf(jsUint8Array) {
+		b := make([]byte, v.Length())
+		js.CopyBytesToGo(b, v)
+		return js.ValueOf(map[string]any{"$bytes": base64.StdEncoding.EncodeToString(b)})
+	}
+	return mapJS(v, portable)
+}
+
+// restore reverses portable.
+func restore(v js.Value) js.Value {
+	if v.Type() != js.TypeObject {
+		return v
+	}
+	if ms := v.Get("$date"); ms.Type() == js.TypeNumber {
+		return jsDate.New(ms)
+	}
+	if s := v.Get("$bytes"); s.Type() == js.TypeString {
+		b, err := base64.StdEncoding.DecodeString(s.String())
+		if err == nil {
+			return bytesToJS(b)
+		}
+	}
+	return mapJS(v, restore)
+}
+
+// mapJS copies an array or plain object, applying fn to every element.
+func mapJS(v js.Value, fn func(js.Value) js.Value) js.Value {
+	if v.InstanceOf(js.Global().Get("Array")) {
+		out := js.Global().Get("Array").New(v.Length())
+		for i := 0; i < v.Length(); i++ {
+			out.SetIndex(i, fn(v.Index(i)))
+		}
+		return out
+	}
+	out := js.Global().Get("Object").New()
+	keys := js.Global().Get("Object").Call("keys", v)
+	for i := 0; i < keys.Length(); i++ {
+		k := keys.Index(i).String()
+		out.Set(k, fn(v.Get(k)))
+	}
+	return out
+}
+
+func stringifyJS(v js.Value) string {
+	return jsJSON.Call("stringify", v).String()
+}
+
+func quoteJSON(s string) string {
+	return stringifyJS(js.ValueOf(s))
+}
+
+// parseJSON parses text with JSON.parse, reporting malformed input as an
+// error instead of a thrown exception.
+func parseJSON(text string) (js.Value, error) {
+	res := jsParse.Invoke(text)
+	if errMsg := res.Get("error"); errMsg.Truthy() {
+		return js.Value{}, fmt.Err("invalid JSON:", errMsg.String())
+	}
+	return res.Get("value"), nil
+}
+
+// jsParse wraps JSON.parse in a try/catch: a JS exception thrown into Go
+// cannot be recovered under TinyGo.
+var jsParse = js.Global().Get("Function").New("text",
+	`try { return {value: JSON.parse(text)}; } catch (e) { return {error: String(e)}; }`)
+
+func splitLines(text string) []string {
+	var lines []string
+	start := 0
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			line := text[start:i]
+			if len(line) > 0 && line[len(line)-1] == '\r' {
+				line = line[:len(line)-1]
+			}
+			lines = append(lines, line)
+			start = i + 1
+		}
+	}
+	if start < len(text) {
+		lines = append(lines, text[start:])
+	}
+	return lines
+}
+
+// exportWriter keeps the first write error.
+type exportWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (e *exportWriter) printf(format string, args ...any) {
+	if e.err != nil {
+		return
+	}
+	_, e.err = io.WriteString(e.w, fmt.Sprintf(format, args...))
+}
+
+var _ Exporter = (*adapter)(nil)
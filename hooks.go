@@ -0,0 +1,65 @@
+//go:build wasm
+
+package indexdb
+
+// Index declares a secondary index over one or more fields. An index with
+// several fields becomes an IndexedDB compound (array keyPath) index, used
+// for equality on its leading fields optionally followed by a range on the
+// next one.
+type Index struct {
+	Name   string // defaults to the field names joined with "+"
+	Fields []string
+	Unique bool
+}
+
+// Indexer is implemented by models that declare indexes beyond the one
+// created for every field.
+type Indexer interface {
+	Indexes() []Index
+}
+
+// NoIndexer is implemented by models that opt fields out of the per-field
+// index, typically large text or JSON columns that are never filtered on.
+// Queries on those fields still work through a store scan. Unique fields
+// cannot opt out: IndexedDB enforces uniqueness through their index.
+type NoIndexer interface {
+	NoIndex() []string
+}
+
+// EncryptedField marks a field stored encrypted at rest. Deterministic
+// encryption gives equal values equal ciphertexts, so the field can still be
+// filtered with =, !=, IN and NOT IN and keep its index, at the cost of revealing
+// which records share a value. Other encrypted fields cannot be filtered on
+// or indexed.
+type EncryptedField struct {
+	Name          string
+	Deterministic bool
+}
+
+// Encrypter is implemented by models with fields to encrypt with AES-GCM
+// before they are stored. The key is given to New with EncryptionKey.
+type Encrypter interface {
+	EncryptedFields() []EncryptedField
+}
+
+// Codec names a CompressionStream format.
+type Codec string
+
+const (
+	Gzip    Codec = "gzip"
+	Deflate Codec = "deflate"
+)
+
+// CompressedField marks a text or raw JSON field stored compressed. Codec
+// defaults to Gzip.
+type CompressedField struct {
+	Name  string
+	Codec Codec
+}
+
+// Compressor is implemented by models with large text fields, such as
+// rendered HTML or JSON payloads, to store compressed. Compressed fields
+// cannot be indexed or filtered on.
+type Compressor interface {
+	CompressedFields() []CompressedField
+}
@@ -0,0 +1,153 @@
+//go:build wasm
+
+package indexdb
+
+import "unicode"
+
+// LIKE patterns follow SQL: % matches any run of characters, _ exactly one,
+// and a backslash makes the next character literal (\%, \_, \\), as in
+// PostgreSQL. Matching works on Unicode code points.
+
+// ILike marks a LIKE pattern as case-insensitive, matching with Unicode
+// simple case folding:
+//
+//	storage.Like("Name", indexdb.ILike("ada%"))
+//
+// A condition with the operator "ILIKE" is matched the same way.
+type ILike string
+
+const likeEscape = '\\'
+
+type likeKind uint8
+
+const (
+	likeLiteral likeKind = iota
+	likeOne              // _
+	likeMany             // %
+)
+
+type likeToken struct {
+	kind likeKind
+	r    rune
+}
+
+// parseLike splits pattern into literal runes and wildcards.
+func parseLike(pattern string) []likeToken {
+	var toks []likeToken
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			toks = append(toks, likeToken{kind: likeLiteral, r: r})
+			escaped = false
+		case r == likeEscape:
+			escaped = true
+		case r == '%':
+			// Consecutive % match the same as one.
+			if n := len(toks); n == 0 || toks[n-1].kind != likeMany {
+				toks = append(toks, likeToken{kind: likeMany})
+			}
+		case r == '_':
+			toks = append(toks, likeToken{kind: likeOne})
+		default:
+			toks = append(toks, likeToken{kind: likeLiteral, r: r})
+		}
+	}
+	// A trailing escape stands for itself.
+	if escaped {
+		toks = append(toks, likeToken{kind: likeLiteral, r: likeEscape})
+	}
+	return toks
+}
+
+// likePattern reads the pattern of a LIKE condition value and whether it
+// asks for case-insensitive matching.
+func likePattern(v any) (pattern string, fold, ok bool) {
+	switch p := v.(type) {
+	case string:
+		return p, false, true
+	case ILike:
+		return string(p), true, true
+	}
+	return "", false, false
+}
+
+// matchLike reports whether s matches the LIKE pattern, folding case when
+// fold is set.
+func matchLike(s, pattern string, fold bool) bool {
+	toks := parseLike(pattern)
+	text := []rune(s)
+	if fold {
+		for i, r := range text {
+			text[i] = foldRune(r)
+		}
+		for i, t := range toks {
+			if t.kind == likeLiteral {
+				toks[i].r = foldRune(t.r)
+			}
+		}
+	}
+
+	// Greedy walk that backtracks to the last % on a mismatch; each % only
+	// ever moves forward, so the match runs in O(len(s) * len(pattern)).
+	ti, si := 0, 0
+	star, starSi := -1, 0
+	for si < len(text) {
+		if ti < len(toks) {
+			switch t := toks[ti]; t.kind {
+			case likeMany:
+				star, starSi = ti, si
+				ti++
+				continue
+			case likeOne:
+				ti++
+				si++
+				continue
+			default:
+				if t.r == text[si] {
+					ti++
+					si++
+					continue
+				}
+			}
+		}
+		if star < 0 {
+			return false
+		}
+		starSi++
+		ti, si = star+1, starSi
+	}
+	for ti < len(toks) && toks[ti].kind == likeMany {
+		ti++
+	}
+	return ti == len(toks)
+}
+
+// foldRune maps r to the smallest rune of its simple case folding orbit, so
+// runes that are equal under folding map alike (K, k and the Kelvin sign).
+func foldRune(r rune) rune {
+	min := r
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		if f < min {
+			min = f
+		}
+	}
+	return min
+}
+
+// likePrefix returns the literal prefix of a case-sensitive pattern up to its
+// first wildcard. Every match starts with it, so it bounds an index range.
+func likePrefix(v any) (string, bool) {
+	pattern, ok := v.(string)
+	if !ok {
+		return "", false
+	}
+	var prefix []rune
+	for _, t := range parseLike(pattern) {
+		if t.kind != likeLiteral {
+			break
+		}
+		prefix = append(prefix, t.r)
+	}
+	return string(prefix), len(prefix) > 0
+}
@@ -0,0 +1,49 @@
+//go:build wasm
+
+package indexdb
+
+import "time"
+
+// Option configures the adapter. Options are passed to New together with the
+// model tables; any argument that is an Option is applied instead of being
+// declared as an object store.
+type Option func(*adapter)
+
+// Version pins the IndexedDB schema version. An upgrade to it makes the
+// database match the declared models, dropping the stores an earlier version
+// recorded and this one removed; a newer database is opened as it is. When
+// omitted the version is derived from the declared models: the adapter bumps
+// it by one whenever a declared store or index is missing, and never drops
+// or alters existing ones. Removed or changed indexes and changed primary
+// keys then stay as they are on disk and are only logged; they take a pinned
+// Version.
+func Version(v int) Option {
+	return func(d *adapter) { d.version = v }
+}
+
+// BatchSize sets how many records a streaming Query fetches per round trip
+// while the caller iterates its Rows. The default is 100.
+func BatchSize(n int) Option {
+	return func(d *adapter) { d.batchSize = n }
+}
+
+// Timeout bounds how long opening the database may take, including an upgrade
+// blocked by other tabs. On expiry the connection reports a timeout error.
+func Timeout(timeout time.Duration) Option {
+	return func(d *adapter) { d.timeout = timeout }
+}
+
+// TxTimeout caps how long a transaction from BeginTx may stay open. A
+// transaction neither committed nor rolled back by then is rolled back, and
+// its calls and Commit report ErrTxExpired. The default is 30 seconds.
+func TxTimeout(timeout time.Duration) Option {
+	return func(d *adapter) { d.txTimeout = timeout }
+}
+
+// EncryptionKey sets the secret the fields declared through Encrypter are
+// encrypted with. It must be at least 16 bytes; the AES-GCM key, and the HMAC
+// key deterministic fields derive their IV from, are derived from it with
+// HKDF. Losing it makes those fields unreadable.
+func EncryptionKey(key []byte) Option {
+	return func(d *adapter) { d.encryptionKey = key }
+}
@@ -0,0 +1,629 @@
+//go:build wasm
+
+package indexdb
+
+import (
+	"syscall/js"
+	"time"
+
+	"github.com/tinywasm/jsvalue"
+	. "github.com/tinywasm/model"
+	"github.com/tinywasm/storage"
+)
+
+// plan describes how a query reads its candidate records: a cursor over the
+// object store or one of its indexes, narrowed by a key range, plus the
+// conditions that still have to be checked in Go. A query whose OR branches
+// can each use an index is planned as a union of branch plans instead.
+type plan struct {
+	index     string   // "" walks the object store itself
+	keyRange  js.Value // undefined walks the whole source
+	direction string   // "next" unless an order was pushed down
+	residual  []storage.Condition
+	keys      []js.Value // exact keys looked up one by one instead of a range
+	branches  []plan     // union of OR branches, merged by primary key
+
+	// keyOnly reads keys instead of records, rebuilding each record from
+	// the source key (sourcePath) and the primary key (pkPath).
+	keyOnly    bool
+	sourcePath []string
+	pkPath     []string
+}
+
+// candidate is a key range usable on one cursor source.
+type candidate struct {
+	index    string
+	keyRange js.Value
+	keys     []js.Value // IN lookups; keyRange is unused when set
+	score    int
+	eqCols   int   // equality columns matched, breaks score ties
+	consumed []int // conditions fully guaranteed by keyRange
+}
+
+func (c *candidate) betterThan(o *candidate) bool {
+	if c == nil {
+		return false
+	}
+	return o == nil || c.score < o.score || (c.score == o.score && c.eqCols > o.eqCols)
+}
+
+// Selectivity scores, lower is better.
+const (
+	scorePKEq = iota
+	scoreUniqueEq
+	scoreEq
+	scoreBounded
+	scoreHalfBounded
+)
+
+// maxBranches caps the OR branches a query with groups expands into; past it
+// the query is a full store scan.
+const maxBranches = 32
+
+// planQuery picks the most selective index usable for conds. With OR
+// branches (see disjuncts) every branch is planned on its own; when each can
+// use an index the plan is their union, otherwise a full store scan.
+func planQuery(store js.Value, s *storeSpec, conds []storage.Condition) plan {
+	full := plan{residual: conds}
+	if s == nil || len(conds) == 0 {
+		return full
+	}
+
+	if !hasGroup(conds) && len(orGroups(conds)) == 1 {
+		if p, ok := planAnd(store, s, conds); ok {
+			return p
+		}
+		return full
+	}
+
+	// Branch residuals are AND chains checked with checkAll, so a flattened
+	// group never has its Logic read again.
+	groups, ok := disjuncts(conds)
+	if !ok {
+		return full
+	}
+	branches := make([]plan, len(groups))
+	for i, g := range groups {
+		p, ok := planAnd(store, s, g)
+		if !ok {
+			return full
+		}
+		branches[i] = p
+	}
+	return plan{branches: branches}
+}
+
+// planAnd picks the most selective index for an AND chain, reporting false
+// when none applies.
+func planAnd(store js.Value, s *storeSpec, conds []storage.Condition) (plan, bool) {
+	indexNames := store.Get("indexNames")
+
+	var best *candidate
+	for _, col := range conditionFields(conds) {
+		source, unique, ok := columnSource(s, indexNames, col)
+		if !ok {
+			continue
+		}
+		c := rangeFor(conds, col, source == "", unique)
+		if c == nil {
+			continue
+		}
+		c.index = source
+		if c.betterThan(best) {
+			best = c
+		}
+	}
+	if len(s.keyPath) > 1 {
+		// A composite primary key ranges like a unique compound index on the store.
+		if c := compoundRange(conds, indexSpec{keyPath: s.keyPath, unique: true}); c.betterThan(best) {
+			best = c
+		}
+	}
+	for _, idx := range s.indexes {
+		if len(idx.keyPath) < 2 || !domStringListHas(indexNames, idx.name) {
+			continue
+		}
+		c := compoundRange(conds, idx)
+		if c != nil && c.betterThan(best) {
+			best = c
+		}
+	}
+	if best == nil {
+		return plan{}, false
+	}
+
+	p := plan{index: best.index, keyRange: best.keyRange, keys: best.keys}
+	for i, c := range conds {
+		if !containsInt(best.consumed, i) {
+			p.residual = append(p.residual, c)
+		}
+	}
+	return p, true
+}
+
+// disjuncts expands conds into OR branches of plain AND chains, distributing
+// each chain over the groups it holds: A, Group(B, Or(C)) reads
+// (A AND B) OR (A AND C). It fails past maxBranches.
+func disjuncts(conds []storage.Condition) ([][]storage.Condition, bool) {
+	var out [][]storage.Condition
+	for _, g := range orGroups(conds) {
+		chains := [][]storage.Condition{nil}
+		for _, c := range g {
+			sub, isGroup := groupOf(c)
+			if !isGroup {
+				for i, chain := range chains {
+					chains[i] = append(chain[:len(chain):len(chain)], c)
+				}
+				continue
+			}
+			subs, ok := disjuncts(sub)
+			if !ok || len(chains)*len(subs) > maxBranches {
+				return nil, false
+			}
+			var next [][]storage.Condition
+			for _, chain := range chains {
+				for _, s := range subs {
+					next = append(next, append(chain[:len(chain):len(chain)], s...))
+				}
+			}
+			chains = next
+		}
+		out = append(out, chains...)
+		if len(out) > maxBranches {
+			return nil, false
+		}
+	}
+	return out, true
+}
+
+// orGroups splits conds at every condition whose Logic is OR. AND binds
+// tighter than OR, as in SQL, so conds match when all the conditions of any
+// one group do: A, Or(B), C reads A OR (B AND C). Parenthesized expressions
+// are GROUP conditions (see groupOf).
+func orGroups(conds []storage.Condition) [][]storage.Condition {
+	var groups [][]storage.Condition
+	start := 0
+	for i := 1; i < len(conds); i++ {
+		if conds[i].Logic() == "OR" {
+			groups = append(groups, conds[start:i])
+			start = i
+		}
+	}
+	return append(groups, conds[start:])
+}
+
+// columnSource returns the cursor source able to range over col: "" for the
+// primary key, the index name for a single-column index.
+func columnSource(s *storeSpec, indexNames js.Value, col string) (source string, unique, ok bool) {
+	if len(s.keyPath) == 1 && s.keyPath[0] == col {
+		return "", true, true
+	}
+	for _, idx := range s.indexes {
+		if len(idx.keyPath) == 1 && idx.keyPath[0] == col && domStringListHas(indexNames, idx.name) {
+			return idx.name, idx.unique, true
+		}
+	}
+	return "", false, false
+}
+
+// rangeFor builds the tightest key range the conditions on col allow, or
+// the key lookups of an IN list. Range predicates stay in the residual set:
+// IndexedDB orders keys across types (numbers before strings) while Go
+// comparisons never match across types, so only equality is dropped from the
+// Go side.
+func rangeFor(conds []storage.Condition, col string, isPK, unique bool) *candidate {
+	keyRange := js.Global().Get("IDBKeyRange")
+
+	var lower, upper js.Value
+	var lowerOpen, upperOpen bool
+	var hasLower, hasUpper bool
+	var lookup *candidate
+
+	eqScore := scoreEq
+	if isPK {
+		eqScore = scorePKEq
+	} else if unique {
+		eqScore = scoreUniqueEq
+	}
+
+	for i, c := range conds {
+		if c.Field() != col {
+			continue
+		}
+		if lo, hi, ok := betweenBounds(c); ok {
+			if !hasLower && !hasUpper {
+				lower, upper, hasLower, hasUpper = lo, hi, true, true
+			}
+			continue
+		}
+		if c.Operator() == "IN" {
+			if keys, ok := inKeys(c.Value()); ok && lookup == nil {
+				lookup = &candidate{keys: keys, score: eqScore, eqCols: 1, consumed: []int{i}}
+			}
+			continue
+		}
+		key, ok := keyValue(c.Value())
+		if !ok {
+			continue
+		}
+		switch c.Operator() {
+		case "=":
+			return &candidate{keyRange: keyRange.Call("only", key), score: eqScore, eqCols: 1, consumed: []int{i}}
+		case ">", ">=":
+			if !hasLower {
+				lower, lowerOpen, hasLower = key, c.Operator() == ">", true
+			}
+		case "<", "<=":
+			if !hasUpper {
+				upper, upperOpen, hasUpper = key, c.Operator() == "<", true
+			}
+		case "LIKE":
+			prefix, ok := likePrefix(c.Value())
+			if ok && !hasLower && !hasUpper {
+				lower, hasLower = js.ValueOf(prefix), true
+				upper, hasUpper = js.ValueOf(prefix+"\uffff"), true
+			}
+		}
+	}
+	if lookup != nil {
+		return lookup
+	}
+
+	switch {
+	case hasLower && hasUpper:
+		// IDBKeyRange.bound throws on an empty range; let the scan find nothing.
+		if cmp := jsCompare(lower, upper); cmp > 0 || (cmp == 0 && (lowerOpen || upperOpen)) {
+			return nil
+		}
+		return &candidate{keyRange: keyRange.Call("bound", lower, upper, lowerOpen, upperOpen), score: scoreBounded}
+	case hasLower:
+		return &candidate{keyRange: keyRange.Call("lowerBound", lower, lowerOpen), score: scoreHalfBounded}
+	case hasUpper:
+		return &candidate{keyRange: keyRange.Call("upperBound", upper, upperOpen), score: scoreHalfBounded}
+	}
+	return nil
+}
+
+// compoundRange builds a range over a compound index from equalities on its
+// leading fields, optionally followed by a range on the next field. Arrays
+// compare element by element and a shorter array sorts first, so [a] is below
+// every [a, x] and [a, []] above all of them (an array outranks any scalar).
+func compoundRange(conds []storage.Condition, idx indexSpec) *candidate {
+	var prefix []any
+	var consumed []int
+	for _, f := range idx.keyPath {
+		i, key, ok := equalityOn(conds, f)
+		if !ok {
+			break
+		}
+		prefix = append(prefix, key)
+		consumed = append(consumed, i)
+	}
+	if len(prefix) == 0 {
+		return nil
+	}
+
+	keyRange := js.Global().Get("IDBKeyRange")
+	if len(prefix) == len(idx.keyPath) {
+		score := scoreEq
+		if idx.name == "" {
+			score = scorePKEq
+		} else if idx.unique {
+			score = scoreUniqueEq
+		}
+		return &candidate{index: idx.name, keyRange: keyRange.Call("only", prefix), score: score, eqCols: len(prefix), consumed: consumed}
+	}
+
+	lower := append([]any{}, prefix...)
+	upper := append(append([]any{}, prefix...), []any{})
+	lowerOpen, upperOpen := false, false
+	eqCols := len(prefix)
+
+	// An IN lookup on the next field has no single range to append; it
+	// stays a residual condition.
+	if r := rangeFor(conds, idx.keyPath[len(prefix)], false, false); r != nil && r.keys == nil {
+		if b := r.keyRange.Get("lower"); !b.IsUndefined() {
+			lower = append(lower, b)
+			lowerOpen = r.keyRange.Get("lowerOpen").Bool()
+		}
+		if b := r.keyRange.Get("upper"); !b.IsUndefined() {
+			upper = append(upper[:len(prefix)], b)
+			upperOpen = r.keyRange.Get("upperOpen").Bool()
+		}
+		eqCols++
+	}
+
+	return &candidate{
+		index:    idx.name,
+		keyRange: keyRange.Call("bound", lower, upper, lowerOpen, upperOpen),
+		score:    scoreEq,
+		eqCols:   eqCols,
+		consumed: consumed,
+	}
+}
+
+// equalityOn finds the first equality on field whose value is a valid key.
+func equalityOn(conds []storage.Condition, field string) (int, js.Value, bool) {
+	for i, c := range conds {
+		if c.Field() != field || c.Operator() != "=" {
+			continue
+		}
+		if key, ok := keyValue(c.Value()); ok {
+			return i, key, true
+		}
+	}
+	return 0, js.Value{}, false
+}
+
+// primaryKeyFields lists the names of the primary key columns in order.
+func primaryKeyFields(fields []Field) []string {
+	var pks []string
+	for _, f := range fields {
+		if f.IsPK() {
+			pks = append(pks, f.Name)
+		}
+	}
+	return pks
+}
+
+// pkLookup returns the store key when conds are AND-ed equalities covering
+// exactly the primary key columns: a scalar for a single column, an array
+// in keyPath order for a composite key.
+func pkLookup(pks []string, conds []storage.Condition) (any, bool) {
+	if len(pks) == 0 || len(conds) != len(pks) {
+		return nil, false
+	}
+	key := make([]any, len(pks))
+	for i, pk := range pks {
+		j, k, ok := equalityOn(conds, pk)
+		if !ok || (j > 0 && conds[j].Logic() == "OR") {
+			return nil, false
+		}
+		key[i] = k
+	}
+	for i := 1; i < len(conds); i++ {
+		if conds[i].Logic() == "OR" {
+			return nil, false
+		}
+	}
+	if len(key) == 1 {
+		return key[0], true
+	}
+	return key, true
+}
+
+func containsString(list []string, v string) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// jsCompare orders two keys the way IndexedDB does.
+func jsCompare(a, b js.Value) int {
+	return js.Global().Get("indexedDB").Call("cmp", a, b).Int()
+}
+
+// keyValue converts a condition value into a valid IndexedDB key.
+// Dates are keys too; booleans and nil are not and can never be range-scanned.
+func keyValue(v any) (js.Value, bool) {
+	switch x := v.(type) {
+	case string, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return jsvalue.ToJS(v), true
+	case time.Time:
+		return dateOf(x), true
+	}
+	return js.Value{}, false
+}
+
+// betweenBounds returns the key bounds of a BETWEEN condition.
+func betweenBounds(c storage.Condition) (lo, hi js.Value, ok bool) {
+	low, high, isBetween := betweenOf(c)
+	if !isBetween {
+		return js.Value{}, js.Value{}, false
+	}
+	lo, okLo := keyValue(low)
+	hi, okHi := keyValue(high)
+	if !okLo || !okHi {
+		return js.Value{}, js.Value{}, false
+	}
+	return lo, hi, true
+}
+
+// inKeys converts an IN list into distinct keys, failing when any item is
+// not a valid key.
+func inKeys(list any) ([]js.Value, bool) {
+	items, ok := listValues(list)
+	if !ok || len(items) == 0 {
+		return nil, false
+	}
+	seen := make(map[string]bool)
+	var keys []js.Value
+	for _, item := range items {
+		key, ok := keyValue(item)
+		if !ok {
+			return nil, false
+		}
+		id := stringifyJS(portable(key))
+		if !seen[id] {
+			seen[id] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys, true
+}
+
+// conditionFields lists the distinct fields referenced by conds in order.
+func conditionFields(conds []storage.Condition) []string {
+	var out []string
+	for _, c := range conds {
+		seen := false
+		for _, f := range out {
+			if f == c.Field() {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			out = append(out, c.Field())
+		}
+	}
+	return out
+}
+
+func containsInt(list []int, v int) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// planOrder pushes a single-column OrderBy down into the cursor direction.
+// It applies when the column has its own source and the filter plan either
+// scans everything or already ranges over that same source. Only text and
+// number columns that always hold a value qualify, i.e. the primary key and
+// NotNull fields: records whose value is not a valid key (booleans, null, a
+// missing column) are missing from an index and would silently drop out of
+// the result, so other columns are sorted in memory.
+func planOrder(store js.Value, s *storeSpec, q storage.Query, p plan) (plan, bool) {
+	if s == nil || len(q.OrderBy) != 1 || len(p.branches) > 0 || len(p.keys) > 0 {
+		return p, false
+	}
+	order := q.OrderBy[0]
+	if !keyOrdered(s, order.Column()) {
+		return p, false
+	}
+	if f, _ := s.field(order.Column()); !f.IsPK() && !f.NotNull {
+		return p, false
+	}
+
+	source, _, ok := columnSource(s, store.Get("indexNames"), order.Column())
+	if !ok {
+		return p, false
+	}
+	if source != p.index && p.keyRange.Truthy() {
+		return p, false
+	}
+	if source != p.index {
+		p = plan{index: source, residual: q.Conditions}
+	}
+
+	p.direction = "next"
+	if order.Dir() == "DESC" {
+		p.direction = "prev"
+	}
+	return p, true
+}
+
+// keyOrdered reports whether the keys of col sort like its values, so a
+// cursor over its source walks them in value order. Only text and number
+// columns qualify, and never encrypted ones: ciphertext order says nothing
+// about the values.
+func keyOrdered(s *storeSpec, col string) bool {
+	f, ok := s.field(col)
+	if !ok || f.Type == nil {
+		return false
+	}
+	if _, ok := s.encryption(col); ok {
+		return false
+	}
+	switch f.Type.Storage() {
+	case FieldText, FieldInt, FieldFloat:
+		return true
+	}
+	return false
+}
+
+// walk visits the records the plan reads, calling fn with each record and its
+// primary key until it returns false. Key lookups fetch every key with
+// getAll, or getAllKeys when the plan reads keys only. A union walks its
+// branches in turn, checking each branch's residual conditions itself and
+// skipping records an earlier branch already produced, so fn sees every
+// matching record once.
+func (p plan) walk(store js.Value, fn func(val, pk js.Value) bool) error {
+	switch {
+	case len(p.branches) > 0:
+		seen := make(map[string]bool)
+		stopped := false
+		for _, b := range p.branches {
+			err := b.walk(store, func(val, pk js.Value) bool {
+				if !checkAll(val, b.residual) {
+					return true
+				}
+				key := stringifyJS(portable(pk))
+				if seen[key] {
+					return true
+				}
+				seen[key] = true
+				if !fn(val, pk) {
+					stopped = true
+					return false
+				}
+				return true
+			})
+			if err != nil || stopped {
+				return err
+			}
+		}
+		return nil
+
+	case len(p.keys) > 0:
+		source := store
+		if p.index != "" {
+			source = store.Call("index", p.index)
+		}
+		// Issue every lookup before awaiting the first.
+		reqs := make([][2]js.Value, len(p.keys))
+		for i, k := range p.keys {
+			reqs[i][1] = source.Call("getAllKeys", k)
+			if !p.keyOnly {
+				reqs[i][0] = source.Call("getAll", k)
+			}
+		}
+		for i, r := range reqs {
+			pks, err := awaitRequest(r[1], "")
+			if err != nil {
+				return err
+			}
+			var vals js.Value
+			if !p.keyOnly {
+				if vals, err = awaitRequest(r[0], ""); err != nil {
+					return err
+				}
+			}
+			for j := 0; j < pks.Length(); j++ {
+				var val js.Value
+				if p.keyOnly {
+					val = p.keyRecord(p.keys[i], pks.Index(j))
+				} else {
+					val = vals.Index(j)
+				}
+				if !fn(val, pks.Index(j)) {
+					return nil
+				}
+			}
+		}
+		return nil
+	}
+
+	return processCursorRequest(p.openCursor(store), func(cursor js.Value) bool {
+		return fn(p.record(cursor), cursor.Get("primaryKey"))
+	})
+}
+
+// openCursor opens a cursor over the plan's source and key range.
+func (p plan) openCursor(store js.Value) js.Value {
+	source := store
+	if p.index != "" {
+		source = store.Call("index", p.index)
+	}
+	direction := p.direction
+	if direction == "" {
+		direction = "next"
+	}
+	return source.Call(p.cursorMethod(), p.keyRange, direction)
+}
@@ -0,0 +1,127 @@
+//go:build wasm
+
+package indexdb
+
+import (
+	"syscall/js"
+
+	"github.com/tinywasm/fmt"
+	. "github.com/tinywasm/model"
+	"github.com/tinywasm/storage"
+)
+
+// Reads with q.Columns return only those fields, in that order: rows report
+// them from Columns and Scan takes one destination per column, and QueryRow
+// and factory models only have the matching pointers set.
+//
+// When the key of the cursor source and the primary key hold every projected
+// column and every column left to check in Go, records are not read at all:
+// a key cursor (or getAllKeys) supplies the keys and the record is rebuilt
+// from them.
+
+// projection returns the fields a read of m returns, and the schema position
+// of each. idx is nil when q names no columns and the whole schema is read.
+func projection(q storage.Query, m Model) (fields []Field, idx []int, err error) {
+	schema := m.Schema()
+	if len(q.Columns) == 0 {
+		return schema, nil, nil
+	}
+	for _, col := range q.Columns {
+		found := false
+		for i, f := range schema {
+			if f.Name == col {
+				fields = append(fields, f)
+				idx = append(idx, i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, nil, fmt.Err("column", col, "not in schema of", m.ModelName())
+		}
+	}
+	return fields, idx, nil
+}
+
+// coverPlan switches p to key-only reads when the key path of its source and
+// the primary key cover cols and the fields of its residual conditions.
+func coverPlan(s *storeSpec, p plan, cols []string) plan {
+	if s == nil || len(cols) == 0 || len(s.keyPath) == 0 {
+		return p
+	}
+	if len(p.branches) > 0 {
+		branches := make([]plan, len(p.branches))
+		for i, b := range p.branches {
+			if branches[i] = coverPlan(s, b, cols); !branches[i].keyOnly {
+				return p
+			}
+		}
+		p.branches = branches
+		return p
+	}
+
+	var sourcePath []string
+	if p.index != "" {
+		found := false
+		for _, idx := range s.indexes {
+			if idx.name == p.index {
+				sourcePath, found = idx.keyPath, true
+				break
+			}
+		}
+		if !found {
+			return p
+		}
+	}
+	covered := append(append([]string(nil), sourcePath...), s.keyPath...)
+	for _, col := range cols {
+		if !containsString(covered, col) {
+			return p
+		}
+	}
+	for _, c := range p.residual {
+		if !containsString(covered, c.Field()) {
+			return p
+		}
+	}
+	p.keyOnly, p.sourcePath, p.pkPath = true, sourcePath, s.keyPath
+	return p
+}
+
+// keyRecord rebuilds the covered fields of a record from the key it has in
+// the plan's source and its primary key.
+func (p plan) keyRecord(key, pk js.Value) js.Value {
+	rec := js.Global().Get("Object").New()
+	setKeyPath(rec, p.pkPath, pk)
+	setKeyPath(rec, p.sourcePath, key)
+	return rec
+}
+
+// setKeyPath copies the parts of key into the fields of path: the key itself
+// for a single field, its elements for a compound path.
+func setKeyPath(rec js.Value, path []string, key js.Value) {
+	if len(path) == 1 {
+		rec.Set(path[0], key)
+		return
+	}
+	for i, f := range path {
+		rec.Set(f, key.Index(i))
+	}
+}
+
+// record returns the record under cursor, rebuilt from its keys when the
+// plan reads keys only.
+func (p plan) record(cursor js.Value) js.Value {
+	if p.keyOnly {
+		return p.keyRecord(cursor.Get("key"), cursor.Get("primaryKey"))
+	}
+	return cursor.Get("value")
+}
+
+// cursorMethod names the request opening the plan's cursor.
+func (p plan) cursorMethod() string {
+	if p.keyOnly {
+		return "openKeyCursor"
+	}
+	return "openCursor"
+}
@@ -0,0 +1,84 @@
+//go:build wasm
+
+package indexdb
+
+import (
+	"syscall/js"
+
+	"github.com/tinywasm/fmt"
+	"github.com/tinywasm/jsvalue"
+)
+
+// StorageEstimate is the origin's storage use as reported by the browser.
+// Both figures are in bytes and cover every storage API of the origin, not
+// just this database.
+type StorageEstimate struct {
+	Usage int64
+	Quota int64
+}
+
+// StorageManager exposes navigator.storage. The connection returned by New
+// implements it; type-assert the storage.Conn to use it.
+//
+// Browsers may evict the data of origins whose storage is not persistent.
+// When a write does not fit in the quota it fails with an error matching
+// ErrQuotaExceeded and nothing is stored, so the app can free space and retry.
+type StorageManager interface {
+	// Estimate reports current usage and quota.
+	Estimate() (StorageEstimate, error)
+	// Persist asks the browser to exempt the origin from eviction and
+	// reports whether it agreed. Browsers may prompt the user or decide
+	// from engagement heuristics.
+	Persist() (bool, error)
+	// Persisted reports whether storage is already persistent.
+	Persisted() (bool, error)
+}
+
+// navigatorStorage returns navigator.storage, which only exists in secure contexts.
+func navigatorStorage() (js.Value, error) {
+	nav := js.Global().Get("navigator")
+	if !nav.Truthy() || !nav.Get("storage").Truthy() {
+		return js.Value{}, fmt.Err("navigator.storage not available")
+	}
+	return nav.Get("storage"), nil
+}
+
+// Estimate implements StorageManager.
+func (d *adapter) Estimate() (StorageEstimate, error) {
+	sm, err := navigatorStorage()
+	if err != nil {
+		return StorageEstimate{}, err
+	}
+	res, err := jsvalue.AwaitPromise(sm.Call("estimate"))
+	if err != nil {
+		return StorageEstimate{}, err
+	}
+	return StorageEstimate{
+		Usage: int64(res.Get("usage").Float()),
+		Quota: int64(res.Get("quota").Float()),
+	}, nil
+}
+
+// Persist implements StorageManager.
+func (d *adapter) Persist() (bool, error) {
+	return storageFlag("persist")
+}
+
+// Persisted implements StorageManager.
+func (d *adapter) Persisted() (bool, error) {
+	return storageFlag("persisted")
+}
+
+func storageFlag(method string) (bool, error) {
+	sm, err := navigatorStorage()
+	if err != nil {
+		return false, err
+	}
+	res, err := jsvalue.AwaitPromise(sm.Call(method))
+	if err != nil {
+		return false, err
+	}
+	return res.Bool(), nil
+}
+
+var _ StorageManager = (*adapter)(nil)
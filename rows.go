@@ -0,0 +1,323 @@
+//go:build wasm
+
+package indexdb
+
+import (
+	"syscall/js"
+
+	"github.com/tinywasm/fmt"
+	. "github.com/tinywasm/model"
+	"github.com/tinywasm/storage"
+)
+
+// defaultBatchSize is how many records a streaming Rows fetches at a time.
+const defaultBatchSize = 100
+
+// cursorRows implements storage.Rows over a live query. Records are fetched
+// in batches; each batch runs in its own short transaction (or inside the
+// explicit one) and resumes right after the last key seen, so memory stays
+// bounded by the batch size and the caller can stop at any time.
+type cursorRows struct {
+	d      *adapter
+	t      *transaction
+	q      storage.Query
+	p      plan
+	fields []Field
+
+	batch []js.Value
+	pos   int
+	cur   js.Value
+
+	lastKey, lastPK js.Value
+	started         bool
+	exhausted       bool
+	closed          bool
+
+	skip    int
+	emitted int
+	err     error
+}
+
+// streamRows returns a streaming Rows for q, or false when the query needs
+// every match in memory first (an ORDER BY that cannot run on a cursor).
+func (d *adapter) streamRows(t *transaction, q storage.Query, fields []Field) (*cursorRows, bool, error) {
+	if q.Action != storage.ActionReadAll {
+		return nil, false, nil
+	}
+	// The packed query stays local: a query read in one pass is packed
+	// again by execute.
+	q, err := d.packQuery(q)
+	if err != nil {
+		return nil, false, err
+	}
+	store, err := d.getStore(t, q.Table, "readonly")
+	if err != nil {
+		return nil, false, err
+	}
+
+	s := d.spec(q.Table)
+	p := planQuery(store, s, q.Conditions)
+	if len(p.branches) > 0 || len(p.keys) > 0 {
+		// Unions and key lookups cannot resume from a single key; read
+		// them in one pass.
+		return nil, false, nil
+	}
+	if len(q.OrderBy) > 0 {
+		op, ok := planOrder(store, s, q, p)
+		if !ok {
+			return nil, false, nil
+		}
+		p = op
+	}
+	p = coverPlan(s, p, q.Columns)
+
+	r := &cursorRows{d: d, t: t, q: q, p: p, fields: fields}
+	if q.Offset > 0 {
+		r.skip = q.Offset
+	}
+	// Fetch the first batch eagerly so setup errors surface from Query.
+	if err := r.fill(); err != nil {
+		return nil, false, err
+	}
+	return r, true, nil
+}
+
+func (r *cursorRows) Next() bool {
+	if r.closed || r.err != nil || r.limitReached() {
+		return false
+	}
+	if r.pos >= len(r.batch) {
+		if err := r.fill(); err != nil {
+			r.err = err
+			return false
+		}
+		if len(r.batch) == 0 {
+			return false
+		}
+	}
+	r.cur = r.batch[r.pos]
+	r.pos++
+	r.emitted++
+	return true
+}
+
+func (r *cursorRows) Scan(dest ...any) error {
+	if !r.cur.Truthy() {
+		return fmt.Err("invalid row cursor")
+	}
+	if len(r.fields) != len(dest) {
+		return fmt.Err("scan destination mismatch with fields")
+	}
+	return scanRecord(r.cur, r.fields, dest)
+}
+
+func (r *cursorRows) Columns() ([]string, error) {
+	cols := make([]string, len(r.fields))
+	for i, f := range r.fields {
+		cols[i] = f.Name
+	}
+	return cols, nil
+}
+
+// Close stops the iteration; no further batch is fetched.
+func (r *cursorRows) Close() error {
+	r.closed = true
+	r.batch = nil
+	return nil
+}
+
+// Err reports the cursor error that ended the iteration, if any.
+func (r *cursorRows) Err() error { return r.err }
+
+func (r *cursorRows) limitReached() bool {
+	return r.q.Limit > 0 && r.emitted >= r.q.Limit
+}
+
+// fill replaces the batch with the next matching records, fetching until at
+// least one matches or the source is exhausted.
+func (r *cursorRows) fill() error {
+	r.batch, r.pos = r.batch[:0], 0
+	for len(r.batch) == 0 && !r.exhausted && !r.closed {
+		store, err := r.d.getStore(r.t, r.q.Table, "readonly")
+		if err != nil {
+			return err
+		}
+		if r.p.index == "" && r.p.direction != "prev" {
+			err = r.fetchAll(store)
+		} else {
+			err = r.fetchCursor(store)
+		}
+		if err != nil {
+			return err
+		}
+		r.started = true
+	}
+	s := r.d.spec(r.q.Table)
+	for _, val := range r.batch {
+		if err := r.d.unpackFields(s, val, r.fields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// batchCount is how many records the next fetch asks for.
+func (r *cursorRows) batchCount() int {
+	n := r.d.batchSize
+	if n <= 0 {
+		n = defaultBatchSize
+	}
+	if r.q.Limit > 0 && len(r.p.residual) == 0 {
+		if rest := r.q.Limit - r.emitted + r.skip; rest < n {
+			n = rest
+		}
+	}
+	return n
+}
+
+// accept applies the residual conditions and the offset to a fetched record.
+func (r *cursorRows) accept(val js.Value) {
+	if !checkConditions(val, r.p.residual) {
+		return
+	}
+	if r.skip > 0 {
+		r.skip--
+		return
+	}
+	r.batch = append(r.batch, val)
+}
+
+// fetchAll prefetches a batch with getAll/getAllKeys on the object store,
+// resuming after the last primary key. A key-only plan skips getAll.
+func (r *cursorRows) fetchAll(store js.Value) error {
+	keyRange := r.p.keyRange
+	if r.started {
+		var ok bool
+		keyRange, ok = narrowRange(r.p.keyRange, r.lastPK, true, false)
+		if !ok {
+			r.exhausted = true
+			return nil
+		}
+	}
+
+	// Requests succeed in the order they are issued, and a success event
+	// fired before its listener is attached is lost: issue the keys first
+	// since they are awaited first.
+	count := r.batchCount()
+	keysReq := store.Call("getAllKeys", keyRange, count)
+	var recsReq js.Value
+	if !r.p.keyOnly {
+		recsReq = store.Call("getAll", keyRange, count)
+	}
+	keys, err := awaitRequest(keysReq, r.q.Table)
+	if err != nil {
+		return err
+	}
+	var recs js.Value
+	if !r.p.keyOnly {
+		if recs, err = awaitRequest(recsReq, r.q.Table); err != nil {
+			return err
+		}
+	}
+
+	n := keys.Length()
+	if n < count {
+		r.exhausted = true
+	}
+	if n > 0 {
+		r.lastPK = keys.Index(n - 1)
+	}
+	for i := 0; i < n; i++ {
+		if r.p.keyOnly {
+			r.accept(r.p.keyRecord(keys.Index(i), keys.Index(i)))
+		} else {
+			r.accept(recs.Index(i))
+		}
+	}
+	return nil
+}
+
+// fetchCursor walks a cursor for one batch. On an index the walk restarts at
+// the last index key and skips the records with that key already emitted.
+func (r *cursorRows) fetchCursor(store js.Value) error {
+	reverse := r.p.direction == "prev"
+	onIndex := r.p.index != ""
+
+	keyRange := r.p.keyRange
+	if r.started {
+		var ok bool
+		keyRange, ok = narrowRange(r.p.keyRange, r.lastKey, !onIndex, reverse)
+		if !ok {
+			r.exhausted = true
+			return nil
+		}
+	}
+
+	source := store
+	if onIndex {
+		source = store.Call("index", r.p.index)
+	}
+	req := source.Call(r.p.cursorMethod(), keyRange, r.p.direction)
+
+	advance := 0
+	if !r.started && len(r.p.residual) == 0 {
+		advance, r.skip = r.skip, 0
+	}
+
+	resumeKey, resumePK := r.lastKey, r.lastPK
+	need := r.batchCount()
+	stopped := false
+
+	err := walkCursor(req, advance, func(cursor js.Value) bool {
+		key, pk := cursor.Get("key"), cursor.Get("primaryKey")
+		if onIndex && r.started && jsCompare(key, resumeKey) == 0 {
+			c := jsCompare(pk, resumePK)
+			if (!reverse && c <= 0) || (reverse && c >= 0) {
+				return true
+			}
+		}
+		r.lastKey, r.lastPK = key, pk
+
+		r.accept(r.p.record(cursor))
+		if len(r.batch) >= need {
+			stopped = true
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if !stopped {
+		r.exhausted = true
+	}
+	return nil
+}
+
+// narrowRange restricts base so the walk starts at from in its direction.
+// It reports false when nothing is left to walk.
+func narrowRange(base, from js.Value, open, reverse bool) (js.Value, bool) {
+	keyRange := js.Global().Get("IDBKeyRange")
+
+	if !reverse {
+		if !base.Truthy() || base.Get("upper").IsUndefined() {
+			return keyRange.Call("lowerBound", from, open), true
+		}
+		upper, upperOpen := base.Get("upper"), base.Get("upperOpen").Bool()
+		if c := jsCompare(from, upper); c > 0 || (c == 0 && (open || upperOpen)) {
+			return js.Value{}, false
+		}
+		return keyRange.Call("bound", from, upper, open, upperOpen), true
+	}
+
+	if !base.Truthy() || base.Get("lower").IsUndefined() {
+		return keyRange.Call("upperBound", from, open), true
+	}
+	lower, lowerOpen := base.Get("lower"), base.Get("lowerOpen").Bool()
+	if c := jsCompare(lower, from); c > 0 || (c == 0 && (open || lowerOpen)) {
+		return js.Value{}, false
+	}
+	return keyRange.Call("bound", lower, from, lowerOpen, open), true
+}
+
+var _ storage.Rows = (*cursorRows)(nil)
@@ -0,0 +1,598 @@
+//go:build wasm
+
+package indexdb
+
+import (
+	"syscall/js"
+
+	"github.com/tinywasm/fmt"
+	. "github.com/tinywasm/model"
+)
+
+// internalStorePrefix marks object stores owned by the adapter itself.
+// Migrations never drop them even though no model declares them.
+const internalStorePrefix = "__"
+
+// storeSpec is the object store layout derived from a Model's Schema.
+type storeSpec struct {
+	name    string
+	keyPath []string
+	autoInc bool
+	indexes []indexSpec
+	fields  []Field
+
+	encrypted  []EncryptedField
+	compressed []CompressedField
+}
+
+// indexSpec describes one secondary index of a store.
+type indexSpec struct {
+	name    string
+	keyPath []string
+	unique  bool
+}
+
+// newStoreSpec builds the store layout for m.
+func newStoreSpec(m Model) (*storeSpec, error) {
+	fields := m.Schema()
+	s := &storeSpec{name: m.ModelName(), fields: fields}
+
+	// Every PK field joins the keyPath; several make an array keyPath.
+	s.keyPath = primaryKeyFields(fields)
+	if len(s.keyPath) == 0 {
+		return nil, fmt.Err("no primary key found in schema for table", s.name)
+	}
+
+	skip, err := s.unindexed(m)
+	if err != nil {
+		return nil, err
+	}
+	if s.encrypted, err = s.encryptedFields(m); err != nil {
+		return nil, err
+	}
+	if s.compressed, err = s.compressedFields(m); err != nil {
+		return nil, err
+	}
+
+	for _, f := range fields {
+		if f.IsAutoInc() {
+			s.autoInc = true
+		}
+		// A single PK is the store key itself; the columns of a composite
+		// key keep their own index so each can be queried alone.
+		if len(s.keyPath) == 1 && f.IsPK() {
+			continue
+		}
+		if containsString(skip, f.Name) {
+			continue
+		}
+		// Randomized ciphertexts and compressed bytes make an index useless.
+		if e, ok := s.encryption(f.Name); ok && !e.Deterministic {
+			continue
+		}
+		if _, ok := s.compression(f.Name); ok {
+			continue
+		}
+		s.indexes = append(s.indexes, indexSpec{name: f.Name, keyPath: []string{f.Name}, unique: f.IsUnique()})
+	}
+
+	if s.autoInc && len(s.keyPath) > 1 {
+		return nil, fmt.Err("autoIncrement requires a single primary key on table", s.name)
+	}
+
+	if ix, ok := m.(Indexer); ok {
+		for _, idx := range ix.Indexes() {
+			spec, err := s.declaredIndex(idx)
+			if err != nil {
+				return nil, err
+			}
+			s.indexes = append(s.indexes, spec)
+		}
+	}
+	return s, nil
+}
+
+// unindexed returns the fields m opts out of indexing through NoIndexer.
+func (s *storeSpec) unindexed(m Model) ([]string, error) {
+	ni, ok := m.(NoIndexer)
+	if !ok {
+		return nil, nil
+	}
+	names := ni.NoIndex()
+	for _, name := range names {
+		f, ok := s.field(name)
+		if !ok {
+			return nil, fmt.Err("unindexed field", name, "not in schema of table", s.name)
+		}
+		if f.IsUnique() {
+			return nil, fmt.Err("unique field", name, "on table", s.name, "requires its index")
+		}
+	}
+	return names, nil
+}
+
+// encryptedFields validates the fields m encrypts through Encrypter. Primary
+// key fields stay in clear, and only deterministic fields may be unique since
+// uniqueness needs their index.
+func (s *storeSpec) encryptedFields(m Model) ([]EncryptedField, error) {
+	en, ok := m.(Encrypter)
+	if !ok {
+		return nil, nil
+	}
+	list := en.EncryptedFields()
+	for _, e := range list {
+		f, ok := s.field(e.Name)
+		if !ok {
+			return nil, fmt.Err("encrypted field", e.Name, "not in schema of table", s.name)
+		}
+		if f.IsPK() {
+			return nil, fmt.Err("primary key", e.Name, "of table", s.name, "cannot be encrypted")
+		}
+		if f.IsUnique() && !e.Deterministic {
+			return nil, fmt.Err("unique field", e.Name, "on table", s.name, "requires deterministic encryption")
+		}
+	}
+	return list, nil
+}
+
+// encryption reports how the field called name is encrypted, if it is.
+func (s *storeSpec) encryption(name string) (EncryptedField, bool) {
+	for _, e := range s.encrypted {
+		if e.Name == name {
+			return e, true
+		}
+	}
+	return EncryptedField{}, false
+}
+
+// compressedFields validates the fields m compresses through Compressor:
+// only text and raw JSON fields outside the primary key and unique
+// constraints qualify.
+func (s *storeSpec) compressedFields(m Model) ([]CompressedField, error) {
+	cm, ok := m.(Compressor)
+	if !ok {
+		return nil, nil
+	}
+	list := cm.CompressedFields()
+	for i, c := range list {
+		f, ok := s.field(c.Name)
+		if !ok {
+			return nil, fmt.Err("compressed field", c.Name, "not in schema of table", s.name)
+		}
+		if f.Type == nil || (f.Type.Storage() != FieldText && f.Type.Storage() != FieldRaw) {
+			return nil, fmt.Err("compressed field", c.Name, "of table", s.name, "is not text")
+		}
+		if f.IsPK() || f.IsUnique() {
+			return nil, fmt.Err("compressed field", c.Name, "of table", s.name, "cannot be a key or unique")
+		}
+		switch c.Codec {
+		case "":
+			list[i].Codec = Gzip
+		case Gzip, Deflate:
+		default:
+			return nil, fmt.Err("unknown codec", string(c.Codec), "for field", c.Name, "of table", s.name)
+		}
+	}
+	return list, nil
+}
+
+// compression returns the declared codec of the field called name, if any.
+func (s *storeSpec) compression(name string) (Codec, bool) {
+	for _, c := range s.compressed {
+		if c.Name == name {
+			return c.Codec, true
+		}
+	}
+	return "", false
+}
+
+// declaredIndex validates an Index declared through Indexer.
+func (s *storeSpec) declaredIndex(idx Index) (indexSpec, error) {
+	if len(idx.Fields) == 0 {
+		return indexSpec{}, fmt.Err("index without fields on table", s.name)
+	}
+	for _, name := range idx.Fields {
+		if _, ok := s.field(name); !ok {
+			return indexSpec{}, fmt.Err("index field", name, "not in schema of table", s.name)
+		}
+		if e, ok := s.encryption(name); ok && !e.Deterministic {
+			return indexSpec{}, fmt.Err("index field", name, "of table", s.name, "is encrypted")
+		}
+		if _, ok := s.compression(name); ok {
+			return indexSpec{}, fmt.Err("index field", name, "of table", s.name, "is compressed")
+		}
+	}
+
+	name := idx.Name
+	if name == "" {
+		for i, f := range idx.Fields {
+			if i > 0 {
+				name += "+"
+			}
+			name += f
+		}
+	}
+	for _, existing := range s.indexes {
+		if existing.name == name {
+			return indexSpec{}, fmt.Err("duplicate index", name, "on table", s.name)
+		}
+	}
+	return indexSpec{name: name, keyPath: idx.Fields, unique: idx.Unique}, nil
+}
+
+// field returns the schema field called name.
+func (s *storeSpec) field(name string) (Field, bool) {
+	for _, f := range s.fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+// keyPathValue returns the keyPath in the shape IndexedDB expects.
+func keyPathValue(path []string) any {
+	if len(path) == 1 {
+		return path[0]
+	}
+	arr := make([]any, len(path))
+	for i, p := range path {
+		arr[i] = p
+	}
+	return arr
+}
+
+// keyPathString flattens a JS keyPath (string or array) for comparison.
+func keyPathString(v js.Value) string {
+	if v.Type() == js.TypeString {
+		return v.String()
+	}
+	if v.Type() != js.TypeObject || !v.InstanceOf(js.Global().Get("Array")) {
+		return ""
+	}
+	out := ""
+	for i := 0; i < v.Length(); i++ {
+		if i > 0 {
+			out += ","
+		}
+		out += v.Index(i).String()
+	}
+	return out
+}
+
+func joinPath(path []string) string {
+	out := ""
+	for i, p := range path {
+		if i > 0 {
+			out += ","
+		}
+		out += p
+	}
+	return out
+}
+
+// domStringListHas reports whether a DOMStringList contains name.
+func domStringListHas(list js.Value, name string) bool {
+	return list.Truthy() && list.Call("contains", name).Bool()
+}
+
+// spec returns the declared layout of table, or nil if it is not declared.
+func (d *adapter) spec(table string) *storeSpec {
+	for _, s := range d.specs {
+		if s.name == table {
+			return s
+		}
+	}
+	return nil
+}
+
+// buildSpecs derives the store layouts from the declared tables.
+func (d *adapter) buildSpecs() {
+	d.specs = nil
+	for i, table := range d.tables {
+		m, ok := table.(Model)
+		if !ok {
+			d.logger("table", i, "does not implement Model interface, skipping")
+			continue
+		}
+		s, err := newStoreSpec(m)
+		if err != nil {
+			d.logger(err)
+			continue
+		}
+		d.specs = append(d.specs, s)
+	}
+}
+
+// schemaMissing reports whether the declared specs need a store or index the
+// opened database lacks, i.e. whether an additive upgrade is needed.
+func (d *adapter) schemaMissing() bool {
+	names := d.db.Get("objectStoreNames")
+	if !domStringListHas(names, metaStore) {
+		return true
+	}
+
+	var existing []any
+	for _, s := range d.specs {
+		if !domStringListHas(names, s.name) {
+			return true
+		}
+		existing = append(existing, s.name)
+	}
+	if len(existing) == 0 {
+		return false
+	}
+
+	tx := d.db.Call("transaction", existing, "readonly")
+	for _, s := range d.specs {
+		indexNames := tx.Call("objectStore", s.name).Get("indexNames")
+		for _, idx := range s.indexes {
+			if !domStringListHas(indexNames, idx.name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// schemaDrifted reports whether the opened database differs from the declared
+// specs, i.e. whether an authoritative upgrade would alter it. Stores the
+// specs do not declare are not drift: other callers may own them.
+func (d *adapter) schemaDrifted() bool {
+	names := d.db.Get("objectStoreNames")
+
+	if !domStringListHas(names, metaStore) {
+		return true
+	}
+
+	var existing []any
+	for _, s := range d.specs {
+		if !domStringListHas(names, s.name) {
+			return true
+		}
+		existing = append(existing, s.name)
+	}
+	if len(existing) == 0 {
+		return false
+	}
+
+	// Store layout is readable synchronously from any transaction; this one
+	// issues no requests and completes on its own.
+	tx := d.db.Call("transaction", existing, "readonly")
+	for _, s := range d.specs {
+		if !storeMatches(tx.Call("objectStore", s.name), s) {
+			return true
+		}
+	}
+	return false
+}
+
+// storeMatches compares an existing object store with its declared spec.
+func storeMatches(store js.Value, s *storeSpec) bool {
+	if !sameKey(store, s) {
+		return false
+	}
+	indexNames := store.Get("indexNames")
+	if indexNames.Length() != len(s.indexes) {
+		return false
+	}
+	for _, idx := range s.indexes {
+		if !domStringListHas(indexNames, idx.name) || !indexMatches(store.Call("index", idx.name), idx) {
+			return false
+		}
+	}
+	return true
+}
+
+func sameKey(store js.Value, s *storeSpec) bool {
+	return keyPathString(store.Get("keyPath")) == joinPath(s.keyPath) &&
+		store.Get("autoIncrement").Bool() == s.autoInc
+}
+
+func indexMatches(index js.Value, idx indexSpec) bool {
+	return keyPathString(index.Get("keyPath")) == joinPath(idx.keyPath) &&
+		index.Get("unique").Bool() == idx.unique
+}
+
+// reconcile runs inside the versionchange transaction tx and brings the
+// database in line with the declared specs. Missing stores and indexes are
+// always created. When full, as for an upgrade to a pinned Version, changed
+// stores and indexes are rebuilt too and the stores an earlier schema
+// recorded but the specs no longer declare are dropped.
+func (d *adapter) reconcile(tx js.Value, full bool) {
+	names := d.db.Get("objectStoreNames")
+	if !domStringListHas(names, metaStore) {
+		d.db.Call("createObjectStore", metaStore, map[string]any{"keyPath": "store"})
+	}
+
+	for _, s := range d.specs {
+		if !domStringListHas(names, s.name) {
+			d.createStore(s)
+			continue
+		}
+
+		store := tx.Call("objectStore", s.name)
+		switch {
+		case !full:
+			createMissingIndexes(store, s)
+		case !sameKey(store, s):
+			d.rebuildStore(store, s)
+		default:
+			reconcileIndexes(store, s)
+		}
+	}
+	d.recordSchema(tx, full)
+}
+
+// recordSchema records in metaStore which stores the schema at the new
+// version declares, keeping the rest of each record such as its codecs. When
+// full it also drops the recorded stores the specs no longer declare; stores
+// never recorded belong to no schema of this adapter and are kept.
+func (d *adapter) recordSchema(tx js.Value, full bool) {
+	meta := tx.Call("objectStore", metaStore)
+	version := d.db.Get("version").Int()
+	req := meta.Call("getAll")
+
+	var onSuccess js.Func
+	onSuccess = js.FuncOf(func(this js.Value, args []js.Value) any {
+		defer onSuccess.Release()
+		records := req.Get("result")
+
+		recorded := make(map[string]js.Value)
+		for i := 0; i < records.Length(); i++ {
+			rec := records.Index(i)
+			recorded[rec.Get("store").String()] = rec
+		}
+
+		for name := range recorded {
+			if !full || d.spec(name) != nil {
+				continue
+			}
+			if domStringListHas(d.db.Get("objectStoreNames"), name) {
+				d.logger("dropping object store", name)
+				d.db.Call("deleteObjectStore", name)
+			}
+			meta.Call("delete", name)
+		}
+
+		for _, s := range d.specs {
+			rec, ok := recorded[s.name]
+			if !ok {
+				rec = js.Global().Get("Object").New()
+				rec.Set("store", s.name)
+			}
+			rec.Set("version", version)
+			meta.Call("put", rec)
+		}
+		return nil
+	})
+	req.Call("addEventListener", "success", onSuccess)
+}
+
+// createStore creates the object store and indexes described by s.
+func (d *adapter) createStore(s *storeSpec) js.Value {
+	opts := map[string]any{"keyPath": keyPathValue(s.keyPath)}
+	if s.autoInc {
+		opts["autoIncrement"] = true
+	}
+	store := d.db.Call("createObjectStore", s.name, opts)
+	for _, idx := range s.indexes {
+		createIndex(store, idx)
+	}
+	return store
+}
+
+func createIndex(store js.Value, idx indexSpec) {
+	store.Call("createIndex", idx.name, keyPathValue(idx.keyPath), map[string]any{"unique": idx.unique})
+}
+
+// reconcileIndexes drops undeclared or changed indexes and creates missing ones.
+func reconcileIndexes(store js.Value, s *storeSpec) {
+	indexNames := store.Get("indexNames")
+
+	var drop []string
+	for i := 0; i < indexNames.Length(); i++ {
+		name := indexNames.Index(i).String()
+		keep := false
+		for _, idx := range s.indexes {
+			if idx.name == name && indexMatches(store.Call("index", name), idx) {
+				keep = true
+				break
+			}
+		}
+		if !keep {
+			drop = append(drop, name)
+		}
+	}
+	for _, name := range drop {
+		store.Call("deleteIndex", name)
+	}
+	createMissingIndexes(store, s)
+}
+
+// createMissingIndexes creates the indexes of s the store lacks.
+func createMissingIndexes(store js.Value, s *storeSpec) {
+	for _, idx := range s.indexes {
+		if !domStringListHas(store.Get("indexNames"), idx.name) {
+			createIndex(store, idx)
+		}
+	}
+}
+
+// rebuildStore recreates a store whose key changed. IndexedDB cannot alter a
+// keyPath in place, so the records are read, the store is recreated and the
+// records are written back, all within the versionchange transaction.
+// Records lacking a valid value for the new key are dropped and logged.
+func (d *adapter) rebuildStore(store js.Value, s *storeSpec) {
+	req := store.Call("getAll")
+
+	var onSuccess js.Func
+	onSuccess = js.FuncOf(func(this js.Value, args []js.Value) any {
+		defer onSuccess.Release()
+		records := req.Get("result")
+
+		d.db.Call("deleteObjectStore", s.name)
+		newStore := d.createStore(s)
+
+		for i := 0; i < records.Length(); i++ {
+			rec := records.Index(i)
+			if !s.acceptsKey(rec) {
+				d.logger("migration of", s.name, "dropped record without a valid key", s.keyPath)
+				continue
+			}
+			newStore.Call("put", rec)
+		}
+		return nil
+	})
+	req.Call("addEventListener", "success", onSuccess)
+}
+
+// hasValidKey reports whether rec carries a valid IndexedDB key for every
+// keyPath entry. Putting a record without one throws synchronously.
+func hasValidKey(rec js.Value, path []string) bool {
+	for _, p := range path {
+		if !isValidKey(rec.Get(p)) {
+			return false
+		}
+	}
+	return true
+}
+
+// acceptsKey reports whether rec can be put in the store of s: with a valid
+// key, or with no key at all when the store generates one.
+func (s *storeSpec) acceptsKey(rec js.Value) bool {
+	if s.autoInc && rec.Get(s.keyPath[0]).IsUndefined() {
+		return true
+	}
+	return hasValidKey(rec, s.keyPath)
+}
+
+// isValidKey reports whether v is a valid IndexedDB key: a number other than
+// NaN, a string, a valid Date, binary data or an array of valid keys.
+func isValidKey(v js.Value) bool {
+	switch v.Type() {
+	case js.TypeNumber:
+		f := v.Float()
+		return f == f
+	case js.TypeString:
+		return true
+	case js.TypeObject:
+	default:
+		return false
+	}
+	if ms, ok := dateMillis(v); ok {
+		return ms == ms
+	}
+	if v.InstanceOf(jsArrayBuffer) || jsArrayBuffer.Call("isView", v).Bool() {
+		return true
+	}
+	if !v.InstanceOf(js.Global().Get("Array")) {
+		return false
+	}
+	for i := 0; i < v.Length(); i++ {
+		if !isValidKey(v.Index(i)) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,144 @@
+//go:build wasm
+
+package tests_test
+
+import (
+	"testing"
+
+	"github.com/tinywasm/indexdb"
+	"github.com/tinywasm/storage"
+)
+
+func TestAggregates(t *testing.T) {
+	db := SetupDB(nil, "aggregate_test", &Product{})
+	defer db.Close()
+
+	seedProducts(t, db,
+		Product{IDProduct: "p1", Name: "apple", Price: 1},
+		Product{IDProduct: "p2", Name: "apple", Price: 3},
+		Product{IDProduct: "p3", Name: "banana", Price: 4},
+		Product{IDProduct: "p4", Name: "cherry", Price: 7},
+	)
+	agg := as[indexdb.Aggregator](t, db)
+
+	totals := func(t *testing.T, conds ...storage.Condition) (count int64, sum, avg, min, max *float64) {
+		t.Helper()
+		q := storage.Query{Table: "product", Conditions: conds}
+		rows, err := agg.Aggregate(q, indexdb.Count("*"), indexdb.Sum("Price"), indexdb.Avg("Price"), indexdb.Min("Price"), indexdb.Max("Price"))
+		if err != nil {
+			t.Fatalf("Aggregate failed: %v", err)
+		}
+		defer rows.Close()
+		if !rows.Next() {
+			t.Fatal("Aggregate without GroupBy returned no row")
+		}
+		if err := rows.Scan(&count, &sum, &avg, &min, &max); err != nil {
+			t.Fatalf("Scan failed: %v", err)
+		}
+		if rows.Next() {
+			t.Fatal("Aggregate without GroupBy returned more than one row")
+		}
+		return
+	}
+
+	t.Run("Unfiltered", func(t *testing.T) {
+		count, sum, avg, min, max := totals(t)
+		if count != 4 || *sum != 15 || *avg != 3.75 || *min != 1 || *max != 7 {
+			t.Fatalf("got count=%d sum=%v avg=%v min=%v max=%v", count, *sum, *avg, *min, *max)
+		}
+	})
+
+	t.Run("IndexRange", func(t *testing.T) {
+		count, sum, _, min, max := totals(t, storage.Gt("Price", 1), storage.Lte("Price", 4))
+		if count != 2 || *sum != 7 || *min != 3 || *max != 4 {
+			t.Fatalf("got count=%d sum=%v min=%v max=%v", count, *sum, *min, *max)
+		}
+	})
+
+	t.Run("KeysOnly", func(t *testing.T) {
+		q := storage.Query{Table: "product", Conditions: []storage.Condition{storage.Gte("Price", 3)}}
+		rows, err := agg.Aggregate(q, indexdb.Count("*"), indexdb.Min("Price"), indexdb.Max("Price"))
+		if err != nil {
+			t.Fatalf("Aggregate failed: %v", err)
+		}
+		defer rows.Close()
+		var count int
+		var min, max float64
+		if !rows.Next() {
+			t.Fatal("no row")
+		}
+		if err := rows.Scan(&count, &min, &max); err != nil {
+			t.Fatalf("Scan failed: %v", err)
+		}
+		if count != 3 || min != 3 || max != 7 {
+			t.Fatalf("got count=%d min=%v max=%v", count, min, max)
+		}
+
+		q = storage.Query{Table: "product", Conditions: []storage.Condition{storage.In("Name", []string{"apple", "cherry"})}}
+		if rows, err = agg.Aggregate(q, indexdb.Count("*")); err != nil {
+			t.Fatalf("Aggregate failed: %v", err)
+		}
+		if !rows.Next() {
+			t.Fatal("no row")
+		}
+		if err := rows.Scan(&count); err != nil || count != 3 {
+			t.Fatalf("COUNT(*) IN lookup = %d, %v; want 3", count, err)
+		}
+	})
+
+	t.Run("Residual", func(t *testing.T) {
+		count, sum, _, _, _ := totals(t, storage.Like("Name", "%an%"), storage.Or(storage.Eq("Name", "cherry")))
+		if count != 2 || *sum != 11 {
+			t.Fatalf("got count=%d sum=%v", count, *sum)
+		}
+	})
+
+	t.Run("NoMatch", func(t *testing.T) {
+		count, sum, avg, min, max := totals(t, storage.Eq("Name", "kiwi"))
+		if count != 0 || sum != nil || avg != nil || min != nil || max != nil {
+			t.Fatalf("got count=%d sum=%v avg=%v min=%v max=%v, want 0 and nulls", count, sum, avg, min, max)
+		}
+	})
+
+	t.Run("GroupBy", func(t *testing.T) {
+		q := storage.Query{
+			Table:   "product",
+			GroupBy: []string{"Name"},
+			OrderBy: []storage.Order{storage.Desc("COUNT(*)"), storage.Asc("Name")},
+			Limit:   2,
+		}
+		rows, err := agg.Aggregate(q, indexdb.Count("*"), indexdb.Sum("Price"))
+		if err != nil {
+			t.Fatalf("Aggregate failed: %v", err)
+		}
+		defer rows.Close()
+
+		cols, _ := rows.Columns()
+		if len(cols) != 3 || cols[0] != "Name" || cols[1] != "COUNT(*)" || cols[2] != "SUM(Price)" {
+			t.Fatalf("Columns = %v", cols)
+		}
+
+		var got []string
+		for rows.Next() {
+			var name string
+			var count int
+			var sum float64
+			if err := rows.Scan(&name, &count, &sum); err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+			got = append(got, name)
+			if name == "apple" && (count != 2 || sum != 4) {
+				t.Fatalf("apple: count=%d sum=%v", count, sum)
+			}
+		}
+		if len(got) != 2 || got[0] != "apple" || got[1] != "banana" {
+			t.Fatalf("groups = %v, want [apple banana]", got)
+		}
+	})
+
+	t.Run("UnknownField", func(t *testing.T) {
+		if _, err := agg.Aggregate(storage.Query{Table: "product"}, indexdb.Sum("Weight")); err == nil {
+			t.Fatal("Aggregate on an unknown field should fail")
+		}
+	})
+}
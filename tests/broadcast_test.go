@@ -0,0 +1,52 @@
+//go:build wasm
+
+package tests_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tinywasm/indexdb"
+)
+
+// Two connections to the same database stand in for two tabs: each joins
+// its own BroadcastChannel object and so hears the other's messages.
+func TestCrossTabChanges(t *testing.T) {
+	dbName := "broadcast_test"
+	tab1 := SetupDB(nil, dbName, &User{})
+	defer tab1.Close()
+	tab2 := SetupDB(nil, dbName, &User{})
+	defer tab2.Close()
+
+	local := 0
+	cancel1 := as[indexdb.Notifier](t, tab1).Subscribe("user", func(c indexdb.Change) {
+		if c.Remote {
+			t.Errorf("tab1 must not receive its own change as remote: %+v", c)
+		}
+		local++
+	})
+	defer cancel1()
+
+	remote := make(chan indexdb.Change, 1)
+	cancel2 := as[indexdb.Notifier](t, tab2).Subscribe("user", func(c indexdb.Change) { remote <- c })
+	defer cancel2()
+
+	if err := tab1.Exec("", createUserQuery("1", "Alice"), &User{}); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	select {
+	case c := <-remote:
+		if !c.Remote || c.Table != "user" || c.Key != "1" {
+			t.Fatalf("Unexpected remote change: %+v", c)
+		}
+		if c.New.Get("Name").String() != "Alice" {
+			t.Fatal("Remote change must carry the new record")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Change was not propagated to the other connection")
+	}
+	if local != 1 {
+		t.Fatalf("Expected 1 local change, got %d", local)
+	}
+}
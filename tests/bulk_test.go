@@ -0,0 +1,55 @@
+//go:build wasm
+
+package tests_test
+
+import (
+	"testing"
+
+	"github.com/tinywasm/indexdb"
+	. "github.com/tinywasm/model"
+	"github.com/tinywasm/storage"
+)
+
+func TestBulkCreateAndUpsert(t *testing.T) {
+	db := SetupDB(nil, "bulk_write_test", &User{})
+	defer db.Close()
+	bw := as[indexdb.BulkWriter](t, db)
+
+	users := []Model{
+		&User{ID: "u1", Name: "Alice"},
+		&User{ID: "u2", Name: "Bob"},
+		&User{Name: "Generated"},
+	}
+	if err := bw.CreateAll(users); err != nil {
+		t.Fatalf("CreateAll failed: %v", err)
+	}
+	if users[2].(*User).ID == "" {
+		t.Fatal("Expected an empty primary key to be generated and written back")
+	}
+
+	// One duplicate must not prevent the other rows from being written.
+	err := bw.CreateAll([]Model{&User{ID: "u3", Name: "Carol"}, &User{ID: "u1", Name: "Dup"}})
+	bulkErr, ok := err.(*indexdb.BulkError)
+	if !ok {
+		t.Fatalf("Expected *indexdb.BulkError, got %v", err)
+	}
+	if len(bulkErr.Failures) != 1 || bulkErr.Failures[0].Index != 1 {
+		t.Fatalf("Expected row 1 to fail, got %+v", bulkErr.Failures)
+	}
+	if err := readUserErr(db, "u3"); err != nil {
+		t.Fatalf("Expected non-failing row to be written: %v", err)
+	}
+
+	if err := bw.UpsertAll([]Model{&User{ID: "u1", Name: "Alicia"}}); err != nil {
+		t.Fatalf("UpsertAll failed: %v", err)
+	}
+	var u User
+	q := storage.Query{
+		Action:     storage.ActionReadOne,
+		Table:      "user",
+		Conditions: []storage.Condition{storage.Eq("ID", "u1")},
+	}
+	if err := db.QueryRow("", q, &u).Scan(); err != nil || u.Name != "Alicia" {
+		t.Fatalf("Expected upserted name Alicia, got %q (%v)", u.Name, err)
+	}
+}
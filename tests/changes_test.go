@@ -0,0 +1,136 @@
+//go:build wasm
+
+package tests_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tinywasm/indexdb"
+	"github.com/tinywasm/storage"
+)
+
+func TestChangeEvents(t *testing.T) {
+	db := SetupDB(nil, "changes_test", &User{})
+	defer db.Close()
+
+	var got []indexdb.Change
+	cancel := as[indexdb.Notifier](t, db).Subscribe("user", func(c indexdb.Change) { got = append(got, c) })
+	defer cancel()
+
+	if err := db.Exec("", createUserQuery("1", "Alice"), &User{}); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	update := storage.Query{
+		Action:     storage.ActionUpdate,
+		Table:      "user",
+		Columns:    []string{"Name"},
+		Values:     []any{"Alicia"},
+		Conditions: []storage.Condition{storage.Eq("ID", "1")},
+	}
+	if err := db.Exec("", update, &User{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	del := storage.Query{
+		Action:     storage.ActionDelete,
+		Table:      "user",
+		Conditions: []storage.Condition{storage.Eq("ID", "1")},
+	}
+	if err := db.Exec("", del, &User{}); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	want := []storage.Action{storage.ActionCreate, storage.ActionUpdate, storage.ActionDelete}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d changes, got %d", len(want), len(got))
+	}
+	for i, c := range got {
+		if c.Table != "user" || c.Action != want[i] || c.Key != "1" {
+			t.Errorf("change %d = %+v", i, c)
+		}
+	}
+	if got[1].Old.Get("Name").String() != "Alice" || got[1].New.Get("Name").String() != "Alicia" {
+		t.Errorf("update change must carry old and new records")
+	}
+	if got[2].Old.Get("Name").String() != "Alicia" {
+		t.Errorf("delete change must carry the deleted record")
+	}
+
+	// Deleting a key that holds no record changes nothing.
+	got = nil
+	if err := db.Exec("", del, &User{}); err != nil {
+		t.Fatalf("Delete of a missing key failed: %v", err)
+	}
+	if len(got) != 0 {
+		t.Fatalf("Delete of a missing key published %+v", got)
+	}
+
+	// Writes inside a transaction are only published on commit.
+	got = nil
+	tx := beginTx(t, db)
+	if err := tx.Exec("", createUserQuery("2", "Bob"), &User{}); err != nil {
+		t.Fatalf("Create in tx failed: %v", err)
+	}
+	if len(got) != 0 {
+		t.Fatal("Changes must wait for commit")
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	if len(got) != 0 {
+		t.Fatal("Rolled back changes must not be published")
+	}
+
+	tx = beginTx(t, db)
+	if err := tx.Exec("", createUserQuery("3", "Carol"), &User{}); err != nil {
+		t.Fatalf("Create in tx failed: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if len(got) != 1 || got[0].Key != "3" {
+		t.Fatalf("Expected the committed create, got %+v", got)
+	}
+}
+
+func TestWatchQuery(t *testing.T) {
+	db := SetupDB(nil, "watch_test", &User{})
+	defer db.Close()
+
+	counts := make(chan int, 8)
+	q := storage.Query{Action: storage.ActionReadAll, Table: "user"}
+	cancel := as[indexdb.Notifier](t, db).Watch(q, &User{}, func(rows storage.Rows, err error) {
+		if err != nil {
+			t.Errorf("Watch query failed: %v", err)
+			return
+		}
+		n := 0
+		for rows.Next() {
+			n++
+		}
+		rows.Close()
+		counts <- n
+	})
+	defer cancel()
+
+	next := func() int {
+		t.Helper()
+		select {
+		case n := <-counts:
+			return n
+		case <-time.After(time.Second):
+			t.Fatal("Watch did not deliver results")
+			return 0
+		}
+	}
+
+	if n := next(); n != 0 {
+		t.Fatalf("Initial run: expected 0 rows, got %d", n)
+	}
+	if err := db.Exec("", createUserQuery("1", "Alice"), &User{}); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if n := next(); n != 1 {
+		t.Fatalf("After create: expected 1 row, got %d", n)
+	}
+}
@@ -0,0 +1,115 @@
+//go:build wasm
+
+package tests_test
+
+import (
+	"testing"
+
+	. "github.com/tinywasm/model"
+	"github.com/tinywasm/storage"
+)
+
+// UserRole is a join table keyed by (UserID, RoleID).
+type UserRole struct {
+	UserID string
+	RoleID string
+	Note   string
+}
+
+func (r *UserRole) ModelName() string { return "user_roles" }
+func (r *UserRole) Schema() []Field {
+	return []Field{
+		{Name: "UserID", Type: Text(), DB: &FieldDB{PK: true}},
+		{Name: "RoleID", Type: Text(), DB: &FieldDB{PK: true}},
+		{Name: "Note", Type: Text()},
+	}
+}
+func (r *UserRole) Pointers() []any             { return []any{&r.UserID, &r.RoleID, &r.Note} }
+func (r *UserRole) EncodeFields(wr FieldWriter) {}
+func (r *UserRole) DecodeFields(rd FieldReader) {}
+func (r *UserRole) IsNil() bool                 { return r == nil }
+
+func TestCompositePrimaryKey(t *testing.T) {
+	db := SetupDB(nil, "composite_pk_test", &UserRole{})
+	defer db.Close()
+
+	for _, r := range []UserRole{{"u1", "admin", "a"}, {"u1", "editor", "b"}, {"u2", "admin", "c"}} {
+		q := storage.Query{
+			Action:  storage.ActionCreate,
+			Table:   "user_roles",
+			Columns: []string{"UserID", "RoleID", "Note"},
+			Values:  []any{r.UserID, r.RoleID, r.Note},
+		}
+		if err := db.Exec("", q, &r); err != nil {
+			t.Fatalf("Create %+v failed: %v", r, err)
+		}
+	}
+
+	byKey := []storage.Condition{storage.Eq("UserID", "u1"), storage.Eq("RoleID", "editor")}
+
+	var got UserRole
+	read := storage.Query{Action: storage.ActionReadOne, Table: "user_roles", Conditions: byKey}
+	if err := db.QueryRow("", read, &got).Scan(); err != nil || got.Note != "b" {
+		t.Fatalf("ReadOne by composite key: got %+v, %v", got, err)
+	}
+
+	update := storage.Query{
+		Action:     storage.ActionUpdate,
+		Table:      "user_roles",
+		Columns:    []string{"Note"},
+		Values:     []any{"changed"},
+		Conditions: byKey,
+	}
+	if err := db.Exec("", update, &UserRole{}); err != nil {
+		t.Fatalf("Update by composite key failed: %v", err)
+	}
+	got = UserRole{}
+	if err := db.QueryRow("", read, &got).Scan(); err != nil || got.Note != "changed" {
+		t.Fatalf("Expected updated note, got %+v, %v", got, err)
+	}
+
+	admins := storage.Query{
+		Action:     storage.ActionReadAll,
+		Table:      "user_roles",
+		Conditions: []storage.Condition{storage.Eq("RoleID", "admin")},
+	}
+	rows, err := db.Query("", admins, &UserRole{})
+	if err != nil {
+		t.Fatalf("ReadAll by second key column failed: %v", err)
+	}
+	n := 0
+	for rows.Next() {
+		n++
+	}
+	rows.Close()
+	if n != 2 {
+		t.Fatalf("Expected 2 admins, got %d", n)
+	}
+
+	// An IN on the second key column leaves the key range to the first.
+	someRoles := storage.Query{
+		Action:     storage.ActionReadAll,
+		Table:      "user_roles",
+		Conditions: []storage.Condition{storage.Eq("UserID", "u1"), storage.In("RoleID", []string{"admin", "viewer"})},
+	}
+	rows, err = db.Query("", someRoles, &UserRole{})
+	if err != nil {
+		t.Fatalf("ReadAll with IN on the second key column failed: %v", err)
+	}
+	n = 0
+	for rows.Next() {
+		n++
+	}
+	rows.Close()
+	if n != 1 {
+		t.Fatalf("Expected 1 role of u1 in the list, got %d", n)
+	}
+
+	del := storage.Query{Action: storage.ActionDelete, Table: "user_roles", Conditions: byKey}
+	if err := db.Exec("", del, &UserRole{}); err != nil {
+		t.Fatalf("Delete by composite key failed: %v", err)
+	}
+	if err := db.QueryRow("", read, &UserRole{}).Scan(); err != storage.ErrNoRows {
+		t.Fatalf("Expected ErrNoRows after delete, got %v", err)
+	}
+}
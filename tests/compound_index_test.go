@@ -0,0 +1,90 @@
+//go:build wasm
+
+package tests_test
+
+import (
+	"testing"
+
+	"github.com/tinywasm/indexdb"
+	. "github.com/tinywasm/model"
+	"github.com/tinywasm/storage"
+)
+
+// TenantEvent declares a compound [TenantID, CreatedAt] index.
+type TenantEvent struct {
+	ID        string
+	TenantID  string
+	CreatedAt int64
+}
+
+func (e *TenantEvent) ModelName() string { return "tenant_events" }
+func (e *TenantEvent) Schema() []Field {
+	return []Field{
+		{Name: "ID", Type: Text(), DB: &FieldDB{PK: true}},
+		{Name: "TenantID", Type: Text()},
+		{Name: "CreatedAt", Type: Int()},
+	}
+}
+func (e *TenantEvent) Pointers() []any             { return []any{&e.ID, &e.TenantID, &e.CreatedAt} }
+func (e *TenantEvent) EncodeFields(wr FieldWriter) {}
+func (e *TenantEvent) DecodeFields(r FieldReader)  {}
+func (e *TenantEvent) IsNil() bool                 { return e == nil }
+func (e *TenantEvent) Indexes() []indexdb.Index {
+	return []indexdb.Index{{Fields: []string{"TenantID", "CreatedAt"}}}
+}
+
+func TestCompoundIndex(t *testing.T) {
+	db := SetupDB(nil, "compound_index_test", &TenantEvent{})
+	defer db.Close()
+
+	events := []TenantEvent{
+		{ID: "e1", TenantID: "a", CreatedAt: 10},
+		{ID: "e2", TenantID: "a", CreatedAt: 20},
+		{ID: "e3", TenantID: "a", CreatedAt: 30},
+		{ID: "e4", TenantID: "b", CreatedAt: 25},
+	}
+	for _, e := range events {
+		q := storage.Query{
+			Action:  storage.ActionCreate,
+			Table:   "tenant_events",
+			Columns: []string{"ID", "TenantID", "CreatedAt"},
+			Values:  []any{e.ID, e.TenantID, e.CreatedAt},
+		}
+		if err := db.Exec("", q, &e); err != nil {
+			t.Fatalf("seed %s: %v", e.ID, err)
+		}
+	}
+
+	count := func(conds ...storage.Condition) int {
+		q := storage.Query{Action: storage.ActionReadAll, Table: "tenant_events", Conditions: conds}
+		rows, err := db.Query("", q, &TenantEvent{})
+		if err != nil {
+			t.Fatalf("ReadAll failed: %v", err)
+		}
+		defer rows.Close()
+		n := 0
+		for rows.Next() {
+			n++
+		}
+		return n
+	}
+
+	cases := []struct {
+		name  string
+		conds []storage.Condition
+		want  int
+	}{
+		{"EqualityAndRange", []storage.Condition{storage.Eq("TenantID", "a"), storage.Gt("CreatedAt", int64(10))}, 2},
+		{"FullEquality", []storage.Condition{storage.Eq("TenantID", "a"), storage.Eq("CreatedAt", int64(30))}, 1},
+		{"PrefixOnly", []storage.Condition{storage.Eq("TenantID", "a")}, 3},
+		{"BoundedRange", []storage.Condition{storage.Eq("TenantID", "a"), storage.Gte("CreatedAt", int64(20)), storage.Lt("CreatedAt", int64(30))}, 1},
+		{"OtherTenant", []storage.Condition{storage.Eq("TenantID", "b"), storage.Lte("CreatedAt", int64(25))}, 1},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := count(c.conds...); got != c.want {
+				t.Fatalf("Expected %d events, got %d", c.want, got)
+			}
+		})
+	}
+}
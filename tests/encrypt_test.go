@@ -0,0 +1,127 @@
+//go:build wasm
+
+package tests_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/tinywasm/indexdb"
+	. "github.com/tinywasm/model"
+	"github.com/tinywasm/storage"
+)
+
+// Patient keeps Name encrypted with a random IV and SSN deterministically,
+// so it can still be looked up.
+type Patient struct {
+	ID   string
+	Name string
+	SSN  string
+}
+
+func (p *Patient) ModelName() string { return "patients" }
+func (p *Patient) Schema() []Field {
+	return []Field{
+		{Name: "ID", Type: Text(), DB: &FieldDB{PK: true}},
+		{Name: "Name", Type: Text()},
+		{Name: "SSN", Type: Text()},
+	}
+}
+func (p *Patient) Pointers() []any             { return []any{&p.ID, &p.Name, &p.SSN} }
+func (p *Patient) EncodeFields(wr FieldWriter) {}
+func (p *Patient) DecodeFields(r FieldReader)  {}
+func (p *Patient) IsNil() bool                 { return p == nil }
+func (p *Patient) EncryptedFields() []indexdb.EncryptedField {
+	return []indexdb.EncryptedField{{Name: "Name"}, {Name: "SSN", Deterministic: true}}
+}
+
+var patientKey = []byte("0123456789abcdef0123456789abcdef")
+
+func TestEncryptedFields(t *testing.T) {
+	db := SetupDB(nil, "encrypt_test", &Patient{}, indexdb.EncryptionKey(patientKey))
+	defer db.Close()
+
+	create := storage.Query{
+		Action:  storage.ActionCreate,
+		Table:   "patients",
+		Columns: []string{"ID", "Name", "SSN"},
+		Values:  []any{"p1", "Ada Lovelace", "123-45-6789"},
+	}
+	if err := db.Exec("", create, &Patient{}); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	// Deterministic fields can be matched by equality.
+	var got Patient
+	read := storage.Query{
+		Action:     storage.ActionReadOne,
+		Table:      "patients",
+		Conditions: []storage.Condition{storage.Eq("SSN", "123-45-6789")},
+	}
+	if err := db.QueryRow("", read, &got).Scan(); err != nil {
+		t.Fatalf("Read by SSN failed: %v", err)
+	}
+	if got.ID != "p1" || got.Name != "Ada Lovelace" || got.SSN != "123-45-6789" {
+		t.Fatalf("Decrypted patient = %+v", got)
+	}
+
+	// NOT IN on a deterministic field excludes the sealed values.
+	notListed := storage.Query{
+		Action:     storage.ActionReadAll,
+		Table:      "patients",
+		Conditions: []storage.Condition{notIn("SSN", []string{"000-00-0000", "123-45-6789"})},
+	}
+	rows, err := db.Query("", notListed, &Patient{})
+	if err != nil {
+		t.Fatalf("NOT IN on SSN failed: %v", err)
+	}
+	if rows.Next() {
+		t.Fatal("NOT IN on SSN matched an excluded value")
+	}
+	rows.Close()
+
+	// Sealing cannot reach inside a group.
+	grouped := storage.Query{
+		Action:     storage.ActionReadAll,
+		Table:      "patients",
+		Conditions: []storage.Condition{group(storage.Eq("SSN", "123-45-6789"))},
+	}
+	if _, err := db.Query("", grouped, &Patient{}); err == nil || !strings.Contains(err.Error(), "group") {
+		t.Fatalf("Grouped filter on encrypted SSN: got %v, want a group error", err)
+	}
+
+	// Randomized fields cannot be filtered on.
+	byName := storage.Query{
+		Action:     storage.ActionReadAll,
+		Table:      "patients",
+		Conditions: []storage.Condition{storage.Eq("Name", "Ada Lovelace")},
+	}
+	if _, err := db.Query("", byName, &Patient{}); err == nil || !strings.Contains(err.Error(), "encrypted") {
+		t.Fatalf("Filter on encrypted Name: got %v, want an encrypted-field error", err)
+	}
+
+	// Nothing readable reaches the store.
+	var buf bytes.Buffer
+	if err := as[indexdb.Exporter](t, db).Export(&buf, indexdb.JSON); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if dump := buf.String(); strings.Contains(dump, "Lovelace") || strings.Contains(dump, "123-45") {
+		t.Fatalf("Plaintext found in stored records: %s", dump)
+	}
+}
+
+func TestEncryptedFieldsRequireKey(t *testing.T) {
+	db := SetupDB(nil, "encrypt_nokey_test", &Patient{})
+	defer db.Close()
+
+	create := storage.Query{
+		Action:  storage.ActionCreate,
+		Table:   "patients",
+		Columns: []string{"ID", "Name", "SSN"},
+		Values:  []any{"p1", "Ada", "1"},
+	}
+	if err := db.Exec("", create, &Patient{}); err == nil {
+		t.Fatal("Create without EncryptionKey should fail")
+	}
+}
@@ -0,0 +1,59 @@
+//go:build wasm
+
+package tests_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/tinywasm/indexdb"
+	. "github.com/tinywasm/model"
+	"github.com/tinywasm/storage"
+)
+
+func createSimpleUser(id, email string) storage.Query {
+	return storage.Query{
+		Action:  storage.ActionCreate,
+		Table:   "simple_users",
+		Columns: []string{"ID", "Email"},
+		Values:  []any{id, email},
+	}
+}
+
+func TestTypedConstraintErrors(t *testing.T) {
+	db := SetupDB(nil, "typed_errors_test", &SimpleUser{})
+	defer db.Close()
+
+	if err := db.Exec("", createSimpleUser("u1", "a@x.com"), &SimpleUser{}); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	// Duplicate value on the unique Email index.
+	err := db.Exec("", createSimpleUser("u2", "a@x.com"), &SimpleUser{})
+	if !errors.Is(err, indexdb.ErrConstraint) {
+		t.Fatalf("Expected ErrConstraint, got %v", err)
+	}
+	var se *indexdb.StoreError
+	if !errors.As(err, &se) {
+		t.Fatalf("Expected a *StoreError, got %T", err)
+	}
+	if se.Table != "simple_users" || se.Index != "Email" || se.Value != "a@x.com" {
+		t.Fatalf("Unexpected error detail: %+v", se)
+	}
+
+	// Duplicate primary key.
+	err = db.Exec("", createSimpleUser("u1", "b@x.com"), &SimpleUser{})
+	if !errors.As(err, &se) || !errors.Is(err, indexdb.ErrConstraint) {
+		t.Fatalf("Expected a constraint StoreError, got %v", err)
+	}
+	if se.Index != "" || se.Value != "u1" {
+		t.Fatalf("Expected the primary key collision, got %+v", se)
+	}
+
+	// Bulk rows report the same typed errors.
+	err = as[indexdb.BulkWriter](t, db).CreateAll([]Model{&SimpleUser{ID: "u3", Email: "a@x.com"}})
+	var be *indexdb.BulkError
+	if !errors.As(err, &be) || len(be.Failures) != 1 || !errors.Is(be.Failures[0], indexdb.ErrConstraint) {
+		t.Fatalf("Expected a constraint failure from CreateAll, got %v", err)
+	}
+}
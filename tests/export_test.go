@@ -0,0 +1,129 @@
+//go:build wasm
+
+package tests_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/tinywasm/indexdb"
+	. "github.com/tinywasm/model"
+	"github.com/tinywasm/storage"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		format indexdb.Format
+	}{
+		{"json", indexdb.JSON},
+		{"ndjson", indexdb.NDJSON},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			src := SetupDB(nil, "export_src_"+tc.name, &User{}, &Asset{})
+			defer src.Close()
+
+			if err := src.Exec("", createUserQuery("1", "Alice"), &User{}); err != nil {
+				t.Fatalf("Create user failed: %v", err)
+			}
+			asset := &Asset{ID: "a1", Data: []byte{0, 255, 7}, Tags: []int{1}, Size: Size{W: 2, H: 3}}
+			if err := as[indexdb.BulkWriter](t, src).CreateAll([]Model{asset}); err != nil {
+				t.Fatalf("Create asset failed: %v", err)
+			}
+
+			var buf bytes.Buffer
+			if err := as[indexdb.Exporter](t, src).Export(&buf, tc.format); err != nil {
+				t.Fatalf("Export failed: %v", err)
+			}
+
+			dst := SetupDB(nil, "export_dst_"+tc.name, &User{}, &Asset{})
+			defer dst.Close()
+			if err := dst.Exec("", createUserQuery("stale", "Old"), &User{}); err != nil {
+				t.Fatalf("Seed dst failed: %v", err)
+			}
+			var changes []indexdb.Change
+			cancel := as[indexdb.Notifier](t, dst).Subscribe("", func(c indexdb.Change) { changes = append(changes, c) })
+			defer cancel()
+			if err := as[indexdb.Exporter](t, dst).Import(bytes.NewReader(buf.Bytes()), tc.format); err != nil {
+				t.Fatalf("Import failed: %v", err)
+			}
+			if len(changes) != 2 || !changes[0].Replaced || !changes[1].Replaced {
+				t.Fatalf("Expected one Replaced change per imported table, got %+v", changes)
+			}
+
+			if err := readUserErr(dst, "1"); err != nil {
+				t.Fatalf("Imported user missing: %v", err)
+			}
+			if err := readUserErr(dst, "stale"); err != storage.ErrNoRows {
+				t.Fatalf("Import must replace store contents, got %v", err)
+			}
+
+			var got Asset
+			read := storage.Query{
+				Action:     storage.ActionReadOne,
+				Table:      "assets",
+				Conditions: []storage.Condition{storage.Eq("ID", "a1")},
+			}
+			if err := dst.QueryRow("", read, &got).Scan(); err != nil {
+				t.Fatalf("Imported asset missing: %v", err)
+			}
+			if !bytes.Equal(got.Data, asset.Data) || got.Size != asset.Size {
+				t.Fatalf("Asset did not round-trip: %+v", got)
+			}
+		})
+	}
+}
+
+func TestImportRejectsUnknownFields(t *testing.T) {
+	db := SetupDB(nil, "import_validate_test", &User{})
+	defer db.Close()
+
+	dump := `{"store":{"name":"user","keyPath":["ID"],"fields":[]}}
+{"record":{"ID":"1","Nickname":"x"}}
+`
+	if err := as[indexdb.Exporter](t, db).Import(strings.NewReader(dump), indexdb.NDJSON); err == nil {
+		t.Fatal("Expected import to reject a field missing from the schema")
+	}
+	if err := readUserErr(db, "1"); err != storage.ErrNoRows {
+		t.Fatalf("A rejected import must not write anything, got %v", err)
+	}
+}
+
+func TestImportRejectsMalformedDumps(t *testing.T) {
+	db := SetupDB(nil, "import_malformed_test", &User{})
+	defer db.Close()
+	ex := as[indexdb.Exporter](t, db)
+
+	const store = `{"store":{"name":"user","keyPath":["ID"],"fields":[]}}` + "\n"
+	cases := []struct {
+		name   string
+		format indexdb.Format
+		dump   string
+	}{
+		{"NullDocument", indexdb.JSON, `null`},
+		{"EntryWithoutStore", indexdb.JSON, `{"stores":[{"records":[]}]}`},
+		{"StoreNotAnObject", indexdb.JSON, `{"stores":[{"store":"user","records":[]}]}`},
+		{"RecordsNotAnArray", indexdb.JSON, `{"stores":[{"store":{"name":"user","keyPath":["ID"]},"records":5}]}`},
+		{"KeyPathNotAnArray", indexdb.NDJSON, `{"store":{"name":"user","keyPath":{}}}`},
+		{"NullStoreLine", indexdb.NDJSON, `{"store":null}`},
+		{"ObjectKey", indexdb.NDJSON, store + `{"record":{"ID":{}}}`},
+		{"ArrayKeyWithObject", indexdb.NDJSON, store + `{"record":{"ID":["1",{}]}}`},
+		{"NullKey", indexdb.NDJSON, store + `{"record":{"ID":null}}`},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := ex.Import(strings.NewReader(c.dump), c.format); err == nil {
+				t.Fatal("Expected import to reject the dump")
+			}
+		})
+	}
+
+	// The connection still imports a valid dump afterwards.
+	if err := ex.Import(strings.NewReader(store+`{"record":{"ID":"1","Name":"Alice"}}`), indexdb.NDJSON); err != nil {
+		t.Fatalf("Import of a valid dump failed: %v", err)
+	}
+	if err := readUserErr(db, "1"); err != nil {
+		t.Fatalf("Expected the valid dump imported: %v", err)
+	}
+}
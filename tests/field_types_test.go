@@ -0,0 +1,137 @@
+//go:build wasm
+
+package tests_test
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/tinywasm/model"
+	"github.com/tinywasm/storage"
+)
+
+var sizeDef = &Definition{Name: "size", Fields: Fields{
+	{Name: "W", Type: Int()},
+	{Name: "H", Type: Int()},
+}}
+
+// Size is a nested struct stored inside Asset.
+type Size struct {
+	W int64
+	H int64
+}
+
+func (s *Size) Schema() []Field { return sizeDef.Fields }
+func (s *Size) Pointers() []any { return []any{&s.W, &s.H} }
+
+// Asset carries every non-scalar field type.
+type Asset struct {
+	ID      string
+	Data    []byte
+	Meta    RawJSON
+	Tags    []int
+	Size    Size
+	Version int64
+}
+
+func (a *Asset) ModelName() string { return "assets" }
+func (a *Asset) Schema() []Field {
+	return []Field{
+		{Name: "ID", Type: Text(), DB: &FieldDB{PK: true}},
+		{Name: "Data", Type: Blob()},
+		{Name: "Meta", Type: Raw()},
+		{Name: "Tags", Type: IntSlice()},
+		{Name: "Size", Type: Struct(sizeDef)},
+		{Name: "Version", Type: Int()},
+	}
+}
+func (a *Asset) Pointers() []any {
+	return []any{&a.ID, &a.Data, &a.Meta, &a.Tags, &a.Size, &a.Version}
+}
+func (a *Asset) EncodeFields(wr FieldWriter) {}
+func (a *Asset) DecodeFields(r FieldReader)  {}
+func (a *Asset) IsNil() bool                 { return a == nil }
+
+func TestFieldTypesRoundTrip(t *testing.T) {
+	db := SetupDB(nil, "field_types_test", &Asset{})
+	defer db.Close()
+
+	in := Asset{
+		ID:      "a1",
+		Data:    []byte{0, 1, 2, 255},
+		Meta:    `{"k":[1,2]}`,
+		Tags:    []int{3, 5, 8},
+		Size:    Size{W: 640, H: 480},
+		Version: 1,
+	}
+	fields := in.Schema()
+	cols := make([]string, len(fields))
+	for i, f := range fields {
+		cols[i] = f.Name
+	}
+	create := storage.Query{
+		Action:  storage.ActionCreate,
+		Table:   "assets",
+		Columns: cols,
+		Values:  ReadValues(fields, in.Pointers()),
+	}
+	if err := db.Exec("", create, &in); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	// Rewriting one column must leave the others intact.
+	update := storage.Query{
+		Action:     storage.ActionUpdate,
+		Table:      "assets",
+		Columns:    []string{"Version"},
+		Values:     []any{int64(2)},
+		Conditions: []storage.Condition{storage.Eq("ID", "a1")},
+	}
+	if err := db.Exec("", update, &Asset{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	check := func(how string, got Asset) {
+		t.Helper()
+		if !bytes.Equal(got.Data, in.Data) {
+			t.Errorf("%s: Data = %v, want %v", how, got.Data, in.Data)
+		}
+		if got.Meta != in.Meta {
+			t.Errorf("%s: Meta = %q, want %q", how, got.Meta, in.Meta)
+		}
+		if len(got.Tags) != 3 || got.Tags[2] != 8 {
+			t.Errorf("%s: Tags = %v", how, got.Tags)
+		}
+		if got.Size != in.Size {
+			t.Errorf("%s: Size = %+v, want %+v", how, got.Size, in.Size)
+		}
+		if got.Version != 2 {
+			t.Errorf("%s: Version = %d, want 2", how, got.Version)
+		}
+	}
+
+	var one Asset
+	read := storage.Query{
+		Action:     storage.ActionReadOne,
+		Table:      "assets",
+		Conditions: []storage.Condition{storage.Eq("ID", "a1")},
+	}
+	if err := db.QueryRow("", read, &one).Scan(); err != nil {
+		t.Fatalf("ReadOne failed: %v", err)
+	}
+	check("ReadOne", one)
+
+	rows, err := db.Query("", storage.Query{Action: storage.ActionReadAll, Table: "assets"}, &Asset{})
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		t.Fatal("Expected one row")
+	}
+	var scanned Asset
+	if err := rows.Scan(scanned.Pointers()...); err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	check("Scan", scanned)
+}
@@ -0,0 +1,49 @@
+//go:build wasm
+
+package tests_test
+
+import (
+	"testing"
+
+	"github.com/tinywasm/indexdb"
+	"github.com/tinywasm/storage"
+)
+
+func TestLikePatterns(t *testing.T) {
+	db := SetupDB(nil, "like_test", &Product{})
+	defer db.Close()
+
+	seedProducts(t, db,
+		Product{IDProduct: "p1", Name: "apple pie"},
+		Product{IDProduct: "p2", Name: "apricot"},
+		Product{IDProduct: "p3", Name: "100% juice"},
+		Product{IDProduct: "p4", Name: "a_b"},
+		Product{IDProduct: "p5", Name: "Árbol Straße"},
+	)
+
+	cases := []struct {
+		name    string
+		pattern any
+		want    int
+	}{
+		{"InnerWildcard", "a%e", 1},
+		{"SeveralWildcards", "%p%i%", 2},
+		{"SingleChar", "a_b", 1},
+		{"SingleCharCount", "ap_____", 1},
+		{"EscapedPercent", "%\\%%", 1},
+		{"EscapedUnderscore", "a\\_%", 1},
+		{"CaseSensitive", "árbol%", 0},
+		{"ILike", indexdb.ILike("árbol%"), 1},
+		{"ILikeUnicode", indexdb.ILike("%STRASSE"), 0},
+		{"ILikeFold", indexdb.ILike("%STRAßE"), 1},
+		{"Literal", "apricot", 1},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := readProducts(t, db, storage.Query{Conditions: []storage.Condition{storage.Like("Name", c.pattern)}})
+			if len(got) != c.want {
+				t.Fatalf("LIKE %v: expected %d products, got %d: %+v", c.pattern, c.want, len(got), got)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+//go:build wasm
+
+package tests_test
+
+import (
+	"syscall/js"
+	"testing"
+
+	"github.com/tinywasm/indexdb"
+	"github.com/tinywasm/jsvalue"
+	. "github.com/tinywasm/model"
+	"github.com/tinywasm/storage"
+)
+
+// Note is stored with every field indexed.
+type Note struct {
+	ID    string
+	Title string
+	Body  string
+}
+
+func (n *Note) ModelName() string { return "notes" }
+func (n *Note) Schema() []Field {
+	return []Field{
+		{Name: "ID", Type: Text(), DB: &FieldDB{PK: true}},
+		{Name: "Title", Type: Text()},
+		{Name: "Body", Type: Text()},
+	}
+}
+func (n *Note) Pointers() []any             { return []any{&n.ID, &n.Title, &n.Body} }
+func (n *Note) EncodeFields(wr FieldWriter) {}
+func (n *Note) DecodeFields(r FieldReader)  {}
+func (n *Note) IsNil() bool                 { return n == nil }
+
+// PlainNote is the same table with Body opted out of indexing.
+type PlainNote struct{ Note }
+
+func (n *PlainNote) NoIndex() []string { return []string{"Body"} }
+
+func TestNoIndexMigration(t *testing.T) {
+	dbName := "noindex_test"
+
+	// hasBodyIndex reports whether the store on disk indexes Body.
+	hasBodyIndex := func(t *testing.T) bool {
+		t.Helper()
+		raw, err := jsvalue.AwaitRequest(js.Global().Get("indexedDB").Call("open", dbName))
+		if err != nil {
+			t.Fatalf("raw open failed: %v", err)
+		}
+		defer raw.Call("close")
+		store := raw.Call("transaction", "notes", "readonly").Call("objectStore", "notes")
+		return store.Get("indexNames").Call("contains", "Body").Bool()
+	}
+
+	db := SetupDB(nil, dbName, indexdb.Version(1), &Note{})
+	create := storage.Query{
+		Action:  storage.ActionCreate,
+		Table:   "notes",
+		Columns: []string{"ID", "Title", "Body"},
+		Values:  []any{"n1", "Groceries", "milk, eggs"},
+	}
+	if err := db.Exec("", create, &Note{}); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	_ = db.Close()
+	if !hasBodyIndex(t) {
+		t.Fatal("Body must be indexed by default")
+	}
+
+	// Opting Body out drops its index on upgrade; filters on it fall back to a scan.
+	db = SetupDB(nil, dbName, indexdb.Version(2), &PlainNote{})
+	var got PlainNote
+	read := storage.Query{
+		Action:     storage.ActionReadOne,
+		Table:      "notes",
+		Conditions: []storage.Condition{storage.Eq("Body", "milk, eggs")},
+	}
+	if err := db.QueryRow("", read, &got).Scan(); err != nil || got.ID != "n1" {
+		t.Fatalf("Query on unindexed field: got %+v, %v", got, err)
+	}
+	_ = db.Close()
+	if hasBodyIndex(t) {
+		t.Fatal("Body index must be dropped after opting it out")
+	}
+
+	// Opting back in rebuilds the index from the stored records.
+	db = SetupDB(nil, dbName, indexdb.Version(3), &Note{})
+	got = PlainNote{}
+	if err := db.QueryRow("", read, &got.Note).Scan(); err != nil || got.ID != "n1" {
+		t.Fatalf("Query on reindexed field: got %+v, %v", got, err)
+	}
+	_ = db.Close()
+	if !hasBodyIndex(t) {
+		t.Fatal("Body index must be created again after opting back in")
+	}
+}
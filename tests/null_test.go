@@ -0,0 +1,128 @@
+//go:build wasm
+
+package tests_test
+
+import (
+	"testing"
+
+	. "github.com/tinywasm/model"
+	"github.com/tinywasm/storage"
+)
+
+// Contact has nullable columns scanned through pointer fields.
+type Contact struct {
+	ID   string
+	Nick *string
+	Age  *int64
+}
+
+func (c *Contact) ModelName() string { return "contacts" }
+func (c *Contact) Schema() []Field {
+	return []Field{
+		{Name: "ID", Type: Text(), DB: &FieldDB{PK: true}},
+		{Name: "Nick", Type: Text()},
+		{Name: "Age", Type: Int()},
+	}
+}
+func (c *Contact) Pointers() []any             { return []any{&c.ID, &c.Nick, &c.Age} }
+func (c *Contact) EncodeFields(wr FieldWriter) {}
+func (c *Contact) DecodeFields(r FieldReader)  {}
+func (c *Contact) IsNil() bool                 { return c == nil }
+
+func TestNullSemantics(t *testing.T) {
+	db := SetupDB(nil, "null_test", &Contact{})
+	defer db.Close()
+
+	nick, age := "ace", int64(30)
+	rows := []struct {
+		id   string
+		nick *string
+		age  *int64
+	}{
+		{"c1", &nick, &age},
+		{"c2", nil, &age},
+		{"c3", nil, nil},
+	}
+	for _, r := range rows {
+		q := storage.Query{
+			Action:  storage.ActionCreate,
+			Table:   "contacts",
+			Columns: []string{"ID", "Nick", "Age"},
+			Values:  []any{r.id, r.nick, r.age},
+		}
+		if err := db.Exec("", q, &Contact{}); err != nil {
+			t.Fatalf("Create %s failed: %v", r.id, err)
+		}
+	}
+
+	count := func(conds ...storage.Condition) int {
+		t.Helper()
+		rs, err := db.Query("", storage.Query{Action: storage.ActionReadAll, Table: "contacts", Conditions: conds}, &Contact{})
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		defer rs.Close()
+		n := 0
+		for rs.Next() {
+			n++
+		}
+		return n
+	}
+
+	if n := count(storage.Eq("Nick", nil)); n != 2 {
+		t.Errorf("Nick IS NULL: got %d rows, want 2", n)
+	}
+	if n := count(storage.IsNotNull("Age")); n != 2 {
+		t.Errorf("Age IS NOT NULL: got %d rows, want 2", n)
+	}
+	// A comparison never matches NULL, != included.
+	if n := count(storage.Neq("Nick", "zed")); n != 1 {
+		t.Errorf("Nick != 'zed': got %d rows, want 1", n)
+	}
+
+	// Ordering on a nullable column keeps the null rows, sorted first.
+	order := func(o storage.Order) string {
+		t.Helper()
+		rs, err := db.Query("", storage.Query{Action: storage.ActionReadAll, Table: "contacts", OrderBy: []storage.Order{o}}, &Contact{})
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		defer rs.Close()
+		ids := ""
+		for rs.Next() {
+			var c Contact
+			if err := rs.Scan(c.Pointers()...); err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+			ids += c.ID + " "
+		}
+		return ids
+	}
+	if got := order(storage.Asc("Age")); got != "c3 c1 c2 " {
+		t.Errorf("ORDER BY Age: got %q, want %q", got, "c3 c1 c2 ")
+	}
+	if got := order(storage.Desc("Nick")); got != "c1 c2 c3 " {
+		t.Errorf("ORDER BY Nick DESC: got %q, want %q", got, "c1 c2 c3 ")
+	}
+
+	c := Contact{Nick: &nick, Age: &age}
+	read := storage.Query{
+		Action:     storage.ActionReadOne,
+		Table:      "contacts",
+		Conditions: []storage.Condition{storage.Eq("ID", "c3")},
+	}
+	if err := db.QueryRow("", read, &c).Scan(); err != nil {
+		t.Fatalf("Read c3 failed: %v", err)
+	}
+	if c.Nick != nil || c.Age != nil {
+		t.Fatalf("NULL columns scanned as %v, %v; want nil pointers", c.Nick, c.Age)
+	}
+
+	read.Conditions = []storage.Condition{storage.Eq("ID", "c1")}
+	if err := db.QueryRow("", read, &c).Scan(); err != nil {
+		t.Fatalf("Read c1 failed: %v", err)
+	}
+	if c.Nick == nil || *c.Nick != "ace" || c.Age == nil || *c.Age != 30 {
+		t.Fatalf("Non-null columns scanned as %v, %v", c.Nick, c.Age)
+	}
+}
@@ -0,0 +1,55 @@
+//go:build wasm
+
+package tests_test
+
+import (
+	"syscall/js"
+	"testing"
+	"time"
+
+	"github.com/tinywasm/indexdb"
+	"github.com/tinywasm/jsvalue"
+)
+
+func TestOpenAsync(t *testing.T) {
+	db, ready := indexdb.Open("open_async_test", &idGenerator{}, nil, &User{})
+	defer db.Close()
+
+	// Operations issued before readiness wait for the open to finish.
+	if err := db.Exec("", createUserQuery("1", "Alice"), &User{}); err != nil {
+		t.Fatalf("Create before ready failed: %v", err)
+	}
+	select {
+	case err := <-ready:
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Open never reported readiness")
+	}
+	if err := readUserErr(db, "1"); err != nil {
+		t.Fatalf("Read after ready failed: %v", err)
+	}
+}
+
+func TestOpenTimeoutPropagates(t *testing.T) {
+	dbName := "open_timeout_test"
+
+	// A raw connection that ignores versionchange blocks any upgrade.
+	req := js.Global().Get("indexedDB").Call("open", dbName)
+	holder, err := jsvalue.AwaitRequest(req)
+	if err != nil {
+		t.Fatalf("raw open failed: %v", err)
+	}
+	defer holder.Call("close")
+
+	db := SetupDB(nil, dbName, indexdb.Timeout(100*time.Millisecond), &User{})
+	defer db.Close()
+
+	if err := db.Exec("", createUserQuery("1", "Alice"), &User{}); err == nil {
+		t.Fatal("Expected the open timeout from the first operation")
+	}
+	if err := readUserErr(db, "1"); err == nil {
+		t.Fatal("Expected reads to fail as well")
+	}
+}
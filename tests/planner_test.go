@@ -0,0 +1,205 @@
+//go:build wasm
+
+package tests_test
+
+import (
+	"testing"
+
+	. "github.com/tinywasm/model"
+	"github.com/tinywasm/storage"
+)
+
+func seedProducts(t *testing.T, db storage.Conn, products ...Product) {
+	t.Helper()
+	for _, p := range products {
+		query := storage.Query{
+			Action:  storage.ActionCreate,
+			Table:   "product",
+			Columns: []string{"IDProduct", "Name", "Price"},
+			Values:  []any{p.IDProduct, p.Name, p.Price},
+		}
+		if err := db.Exec("", query, &p); err != nil {
+			t.Fatalf("seed %s: %v", p.IDProduct, err)
+		}
+	}
+}
+
+func readProducts(t *testing.T, db storage.Conn, q storage.Query) []Product {
+	t.Helper()
+	q.Action = storage.ActionReadAll
+	q.Table = "product"
+	rows, err := db.Query("", q, &Product{}, func() Model { return &Product{} })
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	defer rows.Close()
+
+	var out []Product
+	for rows.Next() {
+		var p Product
+		if err := rows.Scan(&p.IDProduct, &p.Name, &p.Price); err != nil {
+			t.Fatalf("Scan failed: %v", err)
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+func TestIndexPlanner(t *testing.T) {
+	db := SetupDB(nil, "index_planner_test", &Product{})
+	defer db.Close()
+
+	seedProducts(t, db,
+		Product{IDProduct: "p1", Name: "apple", Price: 1},
+		Product{IDProduct: "p2", Name: "apricot", Price: 2.5},
+		Product{IDProduct: "p3", Name: "banana", Price: 4},
+		Product{IDProduct: "p4", Name: "cherry", Price: 7},
+	)
+
+	cases := []struct {
+		name  string
+		conds []storage.Condition
+		want  int
+	}{
+		{"IndexEquality", []storage.Condition{storage.Eq("Name", "banana")}, 1},
+		{"PKEquality", []storage.Condition{storage.Eq("IDProduct", "p4")}, 1},
+		{"BoundedRange", []storage.Condition{storage.Gte("Price", 2.5), storage.Lt("Price", 7)}, 2},
+		{"HalfRange", []storage.Condition{storage.Gt("Price", 2.5)}, 2},
+		{"LikePrefix", []storage.Condition{storage.Like("Name", "ap%")}, 2},
+		{"IndexPlusResidual", []storage.Condition{storage.Like("Name", "ap%"), storage.Gt("Price", 2)}, 1},
+		{"EmptyRange", []storage.Condition{storage.Gt("Price", 3), storage.Lt("Price", 3)}, 0},
+		{"OrUnion", []storage.Condition{storage.Eq("Name", "apple"), storage.Or(storage.Eq("Name", "cherry"))}, 2},
+		{"OrUnionDeduplicates", []storage.Condition{storage.Like("Name", "ap%"), storage.Or(storage.Lt("Price", 2))}, 2},
+		{"AndBindsTighterThanOr", []storage.Condition{storage.Eq("Name", "apple"), storage.Or(storage.Eq("Name", "banana")), storage.Gt("Price", 5)}, 1},
+		{"Between", []storage.Condition{between("Price", 2.5, 4)}, 2},
+		{"BetweenWithResidual", []storage.Condition{between("Price", 1, 7), storage.Like("Name", "%an%")}, 1},
+		{"InLookups", []storage.Condition{storage.In("Name", []string{"apple", "cherry", "apple", "kiwi"})}, 2},
+		{"InOnPK", []storage.Condition{storage.In("IDProduct", []any{"p2", "p3"})}, 2},
+		{"NotIn", []storage.Condition{notIn("Name", []string{"apple", "banana"})}, 2},
+		{"InNarrowInts", []storage.Condition{storage.In("Price", []int32{1, 7})}, 2},
+		{"NotInNarrowInts", []storage.Condition{notIn("Price", []int32{1, 7})}, 2},
+		{"BetweenNarrowInts", []storage.Condition{between("Price", int32(2), int32(4)), storage.Like("Name", "%an%")}, 1},
+		{"InOrIn", []storage.Condition{storage.In("Name", []string{"apple"}), storage.Or(storage.In("Price", []any{1, 7}))}, 2},
+		{"OrOfAndGroups", []storage.Condition{storage.Eq("Name", "apple"), storage.Gt("Price", 5), storage.Or(storage.Eq("Name", "banana")), storage.Lt("Price", 5)}, 1},
+		{"GroupedOr", []storage.Condition{group(storage.Eq("Name", "apple"), storage.Or(storage.Eq("Name", "banana"))), storage.Gt("Price", 2)}, 1},
+		{"OrOfGroups", []storage.Condition{group(storage.Like("Name", "ap%"), storage.Gt("Price", 2)), storage.Or(group(storage.Eq("Name", "cherry")))}, 2},
+		{"NestedGroups", []storage.Condition{group(storage.Eq("Name", "apple"), storage.Or(group(storage.Gte("Price", 4), storage.Lt("Price", 7))))}, 2},
+		{"SingleMemberGroup", []storage.Condition{group(storage.Eq("Name", "banana")), storage.Gt("Price", 2)}, 1},
+		{"OrOfSingleMemberGroups", []storage.Condition{group(storage.Eq("Name", "apple")), storage.Or(group(storage.Eq("Name", "cherry")))}, 2},
+		{"GroupWithScan", []storage.Condition{group(storage.Like("Name", "%an%"), storage.Or(storage.Eq("Name", "apple"))), storage.Lt("Price", 4)}, 1},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := readProducts(t, db, storage.Query{Conditions: c.conds})
+			if len(got) != c.want {
+				t.Fatalf("Expected %d products, got %d: %+v", c.want, len(got), got)
+			}
+		})
+	}
+
+	t.Run("ReadOneByIndexNotPK", func(t *testing.T) {
+		// A value equal to some primary key must not match through the PK.
+		var p Product
+		q := storage.Query{
+			Action:     storage.ActionReadOne,
+			Table:      "product",
+			Conditions: []storage.Condition{storage.Eq("Name", "p1")},
+		}
+		if err := db.QueryRow("", q, &p).Scan(); err != storage.ErrNoRows {
+			t.Fatalf("Expected ErrNoRows, got %v (%+v)", err, p)
+		}
+	})
+}
+
+func TestOrderLimitOffsetPushdown(t *testing.T) {
+	db := SetupDB(nil, "order_pushdown_test", &RequiredProduct{})
+	defer db.Close()
+
+	seedProducts(t, db,
+		Product{IDProduct: "p1", Name: "delta", Price: 4},
+		Product{IDProduct: "p2", Name: "alpha", Price: 1},
+		Product{IDProduct: "p3", Name: "echo", Price: 5},
+		Product{IDProduct: "p4", Name: "charlie", Price: 3},
+		Product{IDProduct: "p5", Name: "bravo", Price: 2},
+	)
+
+	ids := func(ps []Product) string {
+		out := ""
+		for _, p := range ps {
+			out += p.IDProduct + " "
+		}
+		return out
+	}
+
+	cases := []struct {
+		name string
+		q    storage.Query
+		want string
+	}{
+		{"AscPage", storage.Query{OrderBy: []storage.Order{storage.Asc("Price")}, Limit: 2, Offset: 1}, "p5 p4 "},
+		{"DescPage", storage.Query{OrderBy: []storage.Order{storage.Desc("Name")}, Limit: 3}, "p3 p1 p4 "},
+		{"PKDesc", storage.Query{OrderBy: []storage.Order{storage.Desc("IDProduct")}, Offset: 3}, "p2 p1 "},
+		{"RangeAndOrder", storage.Query{
+			Conditions: []storage.Condition{storage.Gte("Price", 2)},
+			OrderBy:    []storage.Order{storage.Desc("Price")},
+			Limit:      2,
+		}, "p3 p1 "},
+		{"ResidualWithOffset", storage.Query{
+			Conditions: []storage.Condition{storage.Neq("Name", "echo")},
+			OrderBy:    []storage.Order{storage.Desc("Price")},
+			Limit:      2,
+			Offset:     1,
+		}, "p4 p5 "},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := ids(readProducts(t, db, c.q)); got != c.want {
+				t.Fatalf("Expected %q, got %q", c.want, got)
+			}
+		})
+	}
+}
+
+func TestOrderKeepsRowsMissingTheColumn(t *testing.T) {
+	db := SetupDB(nil, "order_missing_column_test", &Note{})
+	defer db.Close()
+
+	for _, q := range []storage.Query{
+		{Action: storage.ActionCreate, Table: "notes", Columns: []string{"ID", "Title"}, Values: []any{"n1", "beta"}},
+		{Action: storage.ActionCreate, Table: "notes", Columns: []string{"ID", "Body"}, Values: []any{"n2", "untitled"}},
+		{Action: storage.ActionCreate, Table: "notes", Columns: []string{"ID", "Title"}, Values: []any{"n3", "alpha"}},
+	} {
+		if err := db.Exec("", q, &Note{}); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+	}
+
+	// Title is nullable, so the order cannot come from its index, which
+	// lacks n2.
+	for _, c := range []struct {
+		order storage.Order
+		want  string
+	}{
+		{storage.Asc("Title"), "n2 n3 n1 "},
+		{storage.Desc("Title"), "n1 n3 n2 "},
+	} {
+		rows, err := db.Query("", storage.Query{Action: storage.ActionReadAll, Table: "notes", OrderBy: []storage.Order{c.order}}, &Note{})
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		got := ""
+		for rows.Next() {
+			var n Note
+			if err := rows.Scan(n.Pointers()...); err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+			got += n.ID + " "
+		}
+		rows.Close()
+		if got != c.want {
+			t.Fatalf("%s %s: got %q, want %q", c.order.Column(), c.order.Dir(), got, c.want)
+		}
+	}
+}
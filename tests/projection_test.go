@@ -0,0 +1,142 @@
+//go:build wasm
+
+package tests_test
+
+import (
+	"testing"
+
+	. "github.com/tinywasm/model"
+	"github.com/tinywasm/storage"
+)
+
+func TestProjection(t *testing.T) {
+	db := SetupDB(nil, "projection_test", &Product{})
+	defer db.Close()
+
+	seedProducts(t, db,
+		Product{IDProduct: "p1", Name: "apple", Price: 1},
+		Product{IDProduct: "p2", Name: "apricot", Price: 2.5},
+		Product{IDProduct: "p3", Name: "banana", Price: 4},
+		Product{IDProduct: "p4", Name: "cherry", Price: 7},
+	)
+
+	// scan reads every row of a projected query as a string per column.
+	scan := func(t *testing.T, q storage.Query, want []string) []string {
+		t.Helper()
+		q.Action, q.Table = storage.ActionReadAll, "product"
+		rows, err := db.Query("", q, &Product{})
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		defer rows.Close()
+
+		cols, _ := rows.Columns()
+		if len(cols) != len(want) {
+			t.Fatalf("Columns = %v, want %v", cols, want)
+		}
+		for i := range cols {
+			if cols[i] != want[i] {
+				t.Fatalf("Columns = %v, want %v", cols, want)
+			}
+		}
+
+		var out []string
+		for rows.Next() {
+			dest := make([]any, len(cols))
+			vals := make([]any, len(cols))
+			for i := range dest {
+				dest[i] = &vals[i]
+			}
+			if err := rows.Scan(dest...); err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+			row := ""
+			for _, v := range vals {
+				switch x := v.(type) {
+				case string:
+					row += x + " "
+				default:
+					row += "? "
+				}
+			}
+			out = append(out, row)
+		}
+		return out
+	}
+
+	t.Run("IndexOnly", func(t *testing.T) {
+		got := scan(t, storage.Query{
+			Columns:    []string{"Name", "IDProduct"},
+			Conditions: []storage.Condition{storage.Like("Name", "ap%")},
+		}, []string{"Name", "IDProduct"})
+		if len(got) != 2 || got[0] != "apple p1 " || got[1] != "apricot p2 " {
+			t.Fatalf("rows = %q", got)
+		}
+	})
+
+	t.Run("KeyOnlyStream", func(t *testing.T) {
+		got := scan(t, storage.Query{Columns: []string{"IDProduct"}, Offset: 1, Limit: 2}, []string{"IDProduct"})
+		if len(got) != 2 || got[0] != "p2 " || got[1] != "p3 " {
+			t.Fatalf("rows = %q", got)
+		}
+	})
+
+	t.Run("NotCovered", func(t *testing.T) {
+		got := scan(t, storage.Query{
+			Columns:    []string{"Name"},
+			Conditions: []storage.Condition{storage.In("IDProduct", []string{"p3", "p4"})},
+			OrderBy:    []storage.Order{storage.Desc("Price")},
+		}, []string{"Name"})
+		if len(got) != 2 || got[0] != "cherry " || got[1] != "banana " {
+			t.Fatalf("rows = %q", got)
+		}
+	})
+
+	t.Run("FactoryModels", func(t *testing.T) {
+		q := storage.Query{
+			Action:     storage.ActionReadAll,
+			Table:      "product",
+			Columns:    []string{"Price"},
+			Conditions: []storage.Condition{storage.In("IDProduct", []string{"p4"})},
+		}
+		var models []Model
+		rows, err := db.Query("", q, &Product{}, func() Model {
+			p := &Product{Name: "unset"}
+			models = append(models, p)
+			return p
+		})
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		rows.Close()
+		if len(models) != 1 {
+			t.Fatalf("built %d models, want 1", len(models))
+		}
+		if p := models[0].(*Product); p.Price != 7 || p.Name != "unset" || p.IDProduct != "" {
+			t.Fatalf("projected model = %+v", *p)
+		}
+	})
+
+	t.Run("QueryRow", func(t *testing.T) {
+		got := Product{Price: -1}
+		q := storage.Query{
+			Action:     storage.ActionReadOne,
+			Table:      "product",
+			Columns:    []string{"IDProduct"},
+			Conditions: []storage.Condition{storage.Eq("Name", "banana")},
+		}
+		if err := db.QueryRow("", q, &got).Scan(); err != nil {
+			t.Fatalf("QueryRow failed: %v", err)
+		}
+		if got.IDProduct != "p3" || got.Name != "" || got.Price != -1 {
+			t.Fatalf("projected row = %+v", got)
+		}
+	})
+
+	t.Run("UnknownColumn", func(t *testing.T) {
+		q := storage.Query{Action: storage.ActionReadAll, Table: "product", Columns: []string{"Weight"}}
+		if _, err := db.Query("", q, &Product{}); err == nil {
+			t.Fatal("Query with an unknown column should fail")
+		}
+	})
+}
@@ -0,0 +1,30 @@
+//go:build wasm
+
+package tests_test
+
+import (
+	"testing"
+
+	"github.com/tinywasm/indexdb"
+)
+
+func TestStorageEstimate(t *testing.T) {
+	db := SetupDB(nil, "quota_test", &User{})
+	defer db.Close()
+
+	sm := as[indexdb.StorageManager](t, db)
+	if err := db.Exec("", createUserQuery("1", "Alice"), &User{}); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	est, err := sm.Estimate()
+	if err != nil {
+		t.Fatalf("Estimate failed: %v", err)
+	}
+	if est.Quota <= 0 || est.Usage < 0 || est.Usage > est.Quota {
+		t.Fatalf("Implausible estimate: %+v", est)
+	}
+	if _, err := sm.Persisted(); err != nil {
+		t.Fatalf("Persisted failed: %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+//go:build wasm
+
+package tests_test
+
+import (
+	"testing"
+
+	"github.com/tinywasm/indexdb"
+	"github.com/tinywasm/storage"
+)
+
+func TestStreamingRows(t *testing.T) {
+	db := SetupDB(nil, "streaming_rows_test", indexdb.BatchSize(2), &RequiredProduct{})
+	defer db.Close()
+
+	seedProducts(t, db,
+		Product{IDProduct: "p1", Name: "same", Price: 3},
+		Product{IDProduct: "p2", Name: "same", Price: 1},
+		Product{IDProduct: "p3", Name: "same", Price: 2},
+		Product{IDProduct: "p4", Name: "same", Price: 5},
+		Product{IDProduct: "p5", Name: "other", Price: 4},
+	)
+
+	t.Run("AllBatches", func(t *testing.T) {
+		if got := readProducts(t, db, storage.Query{}); len(got) != 5 {
+			t.Fatalf("Expected 5 rows across batches, got %d", len(got))
+		}
+	})
+
+	t.Run("DuplicateIndexKeysAcrossBatches", func(t *testing.T) {
+		got := readProducts(t, db, storage.Query{OrderBy: []storage.Order{storage.Asc("Name")}})
+		seen := map[string]bool{}
+		for _, p := range got {
+			if seen[p.IDProduct] {
+				t.Fatalf("Row %s emitted twice", p.IDProduct)
+			}
+			seen[p.IDProduct] = true
+		}
+		if len(got) != 5 || got[0].Name != "other" {
+			t.Fatalf("Expected 5 rows starting with 'other', got %+v", got)
+		}
+	})
+
+	t.Run("LimitAndOffset", func(t *testing.T) {
+		got := readProducts(t, db, storage.Query{Limit: 3, Offset: 1})
+		if len(got) != 3 || got[0].IDProduct != "p2" {
+			t.Fatalf("Expected p2..p4, got %+v", got)
+		}
+	})
+
+	t.Run("ResidualFilter", func(t *testing.T) {
+		got := readProducts(t, db, storage.Query{Conditions: []storage.Condition{storage.Gt("Price", 2)}})
+		if len(got) != 3 {
+			t.Fatalf("Expected 3 rows with Price > 2, got %+v", got)
+		}
+	})
+
+	t.Run("CloseStopsIteration", func(t *testing.T) {
+		q := storage.Query{Action: storage.ActionReadAll, Table: "product"}
+		rows, err := db.Query("", q, &Product{})
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		if !rows.Next() {
+			t.Fatal("Expected a first row")
+		}
+		if err := rows.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+		if rows.Next() {
+			t.Fatal("Next must return false after Close")
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatalf("Unexpected Err: %v", err)
+		}
+	})
+}
@@ -0,0 +1,162 @@
+//go:build wasm
+
+package tests_test
+
+import (
+	"testing"
+
+	"github.com/tinywasm/indexdb"
+	. "github.com/tinywasm/model"
+	"github.com/tinywasm/storage"
+)
+
+func TestSchemaMigration(t *testing.T) {
+	dbName := "schema_migration_test"
+
+	db := SetupDB(nil, dbName, &User{})
+	if err := db.Exec("", createUserQuery("1", "Alice"), &User{}); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	_ = db.Close()
+
+	// Declaring a new model on an existing database upgrades it in place.
+	db = SetupDB(nil, dbName, &User{}, &Product{})
+	query := storage.Query{
+		Action:  storage.ActionCreate,
+		Table:   "product",
+		Columns: []string{"IDProduct", "Name", "Price"},
+		Values:  []any{"p1", "Pen", 1.5},
+	}
+	if err := db.Exec("", query, &Product{}); err != nil {
+		t.Fatalf("Create on store added by migration failed: %v", err)
+	}
+	_ = db.Close()
+
+	readProduct := storage.Query{
+		Action:     storage.ActionReadOne,
+		Table:      "product",
+		Conditions: []storage.Condition{storage.Eq("IDProduct", "p1")},
+	}
+
+	// A caller declaring only some of the models, such as a worker or a tab
+	// running an older build, leaves the other stores alone.
+	db = SetupDB(nil, dbName, &Product{})
+	var p Product
+	if err := db.QueryRow("", readProduct, &p).Scan(); err != nil {
+		t.Fatalf("Records must survive unrelated migrations: %v", err)
+	}
+	_ = db.Close()
+
+	db = SetupDB(nil, dbName, &User{})
+	if err := readUserErr(db, "1"); err != nil {
+		t.Fatalf("A partial declaration must not drop other stores: %v", err)
+	}
+	_ = db.Close()
+
+	// Upgrading to a pinned Version drops the stores an earlier schema
+	// declared and this one removed.
+	db = SetupDB(nil, dbName, indexdb.Version(5), &Product{})
+	if err := db.QueryRow("", readProduct, &p).Scan(); err != nil {
+		t.Fatalf("Records must survive unrelated migrations: %v", err)
+	}
+	_ = db.Close()
+
+	db = SetupDB(nil, dbName, &User{})
+	if err := readUserErr(db, "1"); err == nil {
+		t.Fatal("Expected the store dropped by the pinned upgrade to be empty")
+	}
+	_ = db.Close()
+
+	// An older pinned Version opens the newer database as it is.
+	db = SetupDB(nil, dbName, indexdb.Version(2), &Product{})
+	defer db.Close()
+	if err := db.QueryRow("", readProduct, &p).Scan(); err != nil {
+		t.Fatalf("Opening with an older Version failed: %v", err)
+	}
+}
+
+func TestSchemaVersionOption(t *testing.T) {
+	db := SetupDB(nil, "schema_version_test", indexdb.Version(3), &User{})
+	defer db.Close()
+
+	query := storage.Query{
+		Action:  storage.ActionCreate,
+		Table:   "user",
+		Columns: []string{"ID", "Name", "Email"},
+		Values:  []any{"1", "Alice", "alice@example.com"},
+	}
+	if err := db.Exec("", query, &User{}); err != nil {
+		t.Fatalf("Create with pinned version failed: %v", err)
+	}
+}
+
+// Badge is keyed by ID; CodedBadge declares the same table keyed by Code.
+type Badge struct {
+	ID    string
+	Code  string
+	Label string
+}
+
+func (b *Badge) ModelName() string { return "badges" }
+func (b *Badge) Schema() []Field {
+	return []Field{
+		{Name: "ID", Type: Text(), DB: &FieldDB{PK: true}},
+		{Name: "Code", Type: Text()},
+		{Name: "Label", Type: Text()},
+	}
+}
+func (b *Badge) Values() []any               { return []any{b.ID, b.Code, b.Label} }
+func (b *Badge) Pointers() []any             { return []any{&b.ID, &b.Code, &b.Label} }
+func (b *Badge) EncodeFields(wr FieldWriter) {}
+func (b *Badge) DecodeFields(r FieldReader)  {}
+func (b *Badge) IsNil() bool                 { return b == nil }
+
+type CodedBadge struct {
+	Badge
+}
+
+func (b *CodedBadge) Schema() []Field {
+	return []Field{
+		{Name: "ID", Type: Text()},
+		{Name: "Code", Type: Text(), DB: &FieldDB{PK: true}},
+		{Name: "Label", Type: Text()},
+	}
+}
+
+func TestPrimaryKeyChange(t *testing.T) {
+	dbName := "primary_key_change_test"
+
+	db := SetupDB(nil, dbName, indexdb.Version(1), &Badge{})
+	for _, q := range []storage.Query{
+		{Action: storage.ActionCreate, Table: "badges", Columns: []string{"ID", "Code", "Label"}, Values: []any{"b1", "x", "one"}},
+		{Action: storage.ActionCreate, Table: "badges", Columns: []string{"ID", "Label"}, Values: []any{"b2", "two"}},
+	} {
+		if err := db.Exec("", q, &Badge{}); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+	}
+	_ = db.Close()
+
+	byID := storage.Query{Action: storage.ActionReadOne, Table: "badges", Conditions: []storage.Condition{storage.Eq("ID", "b2")}}
+	byCode := storage.Query{Action: storage.ActionReadOne, Table: "badges", Conditions: []storage.Condition{storage.Eq("Code", "x")}}
+
+	// Without a pinned Version the store keeps its old key.
+	db = SetupDB(nil, dbName, &CodedBadge{})
+	if err := db.QueryRow("", byID, &CodedBadge{}).Scan(); err != nil {
+		t.Fatalf("Expected the store left as it is: %v", err)
+	}
+	_ = db.Close()
+
+	// Upgrading to a pinned Version, above the one the derived upgrade for
+	// the new ID index reached, rebuilds the store on the new key and drops
+	// the record that has none.
+	db = SetupDB(nil, dbName, indexdb.Version(5), &CodedBadge{})
+	defer db.Close()
+	var b CodedBadge
+	if err := db.QueryRow("", byCode, &b).Scan(); err != nil || b.Label != "one" {
+		t.Fatalf("Expected the record kept on its new key, got %+v, %v", b, err)
+	}
+	if err := db.QueryRow("", byID, &CodedBadge{}).Scan(); err != storage.ErrNoRows {
+		t.Fatalf("Expected the record without a Code dropped, got %v", err)
+	}
+}
@@ -4,6 +4,9 @@ package tests_test
 
 import (
 	"fmt"
+	"reflect"
+	"testing"
+	"unsafe"
 
 	"github.com/tinywasm/indexdb"
 	. "github.com/tinywasm/model"
@@ -36,6 +39,17 @@ func SetupDB(logger func(...any), dbName string, structTables ...any) storage.Co
 	return db
 }
 
+// as returns db as one of the optional interfaces the connection
+// implements, such as indexdb.Exporter, failing the test when it does not.
+func as[T any](t *testing.T, db storage.Conn) T {
+	t.Helper()
+	v, ok := db.(T)
+	if !ok {
+		t.Fatalf("indexdb connection must implement %T", (*T)(nil))
+	}
+	return v
+}
+
 // User represents a sample struct for testing table creation
 type User struct {
 	ID    string
@@ -79,3 +93,56 @@ func (p *Product) Pointers() []any             { return []any{&p.IDProduct, &p.N
 func (p *Product) EncodeFields(wr FieldWriter) {}
 func (p *Product) DecodeFields(r FieldReader)  {}
 func (p *Product) IsNil() bool                 { return p == nil }
+
+// RequiredProduct declares the product table with NotNull Name and Price,
+// so an ORDER BY on them can be read from their indexes.
+type RequiredProduct struct {
+	Product
+}
+
+func (p *RequiredProduct) Schema() []Field {
+	return []Field{
+		{Name: "IDProduct", Type: Text(), DB: &FieldDB{PK: true}},
+		{Name: "Name", Type: Text(), NotNull: true},
+		{Name: "Price", Type: Float(), NotNull: true},
+	}
+}
+
+// between, notIn and group stand in for storage.Between, storage.NotIn and
+// storage.Group, which storage v0.0.2 does not have yet: they build the
+// conditions those constructors return, with the operators "BETWEEN",
+// "NOT IN" and "GROUP". Replace them with the constructors once storage
+// exports them.
+func between(field string, low, high any) storage.Condition {
+	return condition(field, "BETWEEN", []any{low, high})
+}
+
+func notIn(field string, list any) storage.Condition {
+	return condition(field, "NOT IN", list)
+}
+
+func group(conds ...storage.Condition) storage.Condition {
+	return condition("", "GROUP", conds)
+}
+
+// condition sets the unexported fields of a storage.Condition. It panics if
+// their layout no longer matches, rather than building a wrong condition.
+func condition(field, op string, value any) storage.Condition {
+	var c storage.Condition
+	v := reflect.ValueOf(&c).Elem()
+	set := func(name string, x any) {
+		f := v.FieldByName(name)
+		if !f.IsValid() || !reflect.TypeOf(x).AssignableTo(f.Type()) {
+			panic("storage.Condition has no " + name + " field of type " + reflect.TypeOf(x).String() + "; use the storage constructors")
+		}
+		reflect.NewAt(f.Type(), unsafe.Pointer(f.UnsafeAddr())).Elem().Set(reflect.ValueOf(x))
+	}
+	set("field", field)
+	set("operator", op)
+	set("value", value)
+	set("logic", "AND")
+	if c.Field() != field || c.Operator() != op || c.Logic() != "AND" {
+		panic("storage.Condition no longer reads back its fields; use the storage constructors")
+	}
+	return c
+}
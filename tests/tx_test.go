@@ -0,0 +1,165 @@
+//go:build wasm
+
+package tests_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tinywasm/indexdb"
+	"github.com/tinywasm/storage"
+)
+
+func createUserQuery(id, name string) storage.Query {
+	return storage.Query{
+		Action:  storage.ActionCreate,
+		Table:   "user",
+		Columns: []string{"ID", "Name", "Email"},
+		Values:  []any{id, name, name + "@example.com"},
+	}
+}
+
+func readUserErr(db storage.Executor, id string) error {
+	q := storage.Query{
+		Action:     storage.ActionReadOne,
+		Table:      "user",
+		Conditions: []storage.Condition{storage.Eq("ID", id)},
+	}
+	return db.QueryRow("", q, &User{}).Scan()
+}
+
+func beginTx(t *testing.T, db storage.Conn) storage.TxBoundExecutor {
+	t.Helper()
+	txe, ok := db.(storage.TxExecutor)
+	if !ok {
+		t.Fatal("indexdb connection must implement storage.TxExecutor")
+	}
+	tx, err := txe.BeginTx()
+	if err != nil {
+		t.Fatalf("BeginTx failed: %v", err)
+	}
+	return tx
+}
+
+func TestTransactionCommit(t *testing.T) {
+	db := SetupDB(nil, "tx_commit_test", &User{})
+	defer db.Close()
+
+	tx := beginTx(t, db)
+	if err := tx.Exec("", createUserQuery("1", "Alice"), &User{}); err != nil {
+		t.Fatalf("Create in tx failed: %v", err)
+	}
+
+	// Idle time between statements must not auto-commit the transaction.
+	time.Sleep(50 * time.Millisecond)
+
+	update := storage.Query{
+		Action:     storage.ActionUpdate,
+		Table:      "user",
+		Columns:    []string{"Name"},
+		Values:     []any{"Alicia"},
+		Conditions: []storage.Condition{storage.Eq("ID", "1")},
+	}
+	if err := tx.Exec("", update, &User{}); err != nil {
+		t.Fatalf("Update in tx after idle failed: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	var u User
+	q := storage.Query{
+		Action:     storage.ActionReadOne,
+		Table:      "user",
+		Conditions: []storage.Condition{storage.Eq("ID", "1")},
+	}
+	if err := db.QueryRow("", q, &u).Scan(); err != nil {
+		t.Fatalf("Read after commit failed: %v", err)
+	}
+	if u.Name != "Alicia" {
+		t.Fatalf("Expected committed name Alicia, got %s", u.Name)
+	}
+}
+
+func TestTransactionRollback(t *testing.T) {
+	db := SetupDB(nil, "tx_rollback_test", &User{})
+	defer db.Close()
+
+	tx := beginTx(t, db)
+	if err := tx.Exec("", createUserQuery("1", "Alice"), &User{}); err != nil {
+		t.Fatalf("Create in tx failed: %v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+
+	if err := readUserErr(db, "1"); err != storage.ErrNoRows {
+		t.Fatalf("Expected ErrNoRows after rollback, got %v", err)
+	}
+	if err := tx.Exec("", createUserQuery("2", "Bob"), &User{}); err == nil {
+		t.Fatal("Expected error using a rolled back transaction")
+	}
+}
+
+func TestTransactionFailureAbortsAll(t *testing.T) {
+	db := SetupDB(nil, "tx_failure_test", &User{})
+	defer db.Close()
+
+	tx := beginTx(t, db)
+	if err := tx.Exec("", createUserQuery("1", "Alice"), &User{}); err != nil {
+		t.Fatalf("Create in tx failed: %v", err)
+	}
+	if err := tx.Exec("", createUserQuery("1", "Alice"), &User{}); err == nil {
+		t.Fatal("Expected duplicate key error")
+	}
+	if err := tx.Commit(); err == nil {
+		t.Fatal("Expected Commit to report the aborted transaction")
+	}
+
+	if err := readUserErr(db, "1"); err != storage.ErrNoRows {
+		t.Fatalf("Expected no partial writes, got %v", err)
+	}
+}
+
+func TestForgottenTransactionExpires(t *testing.T) {
+	db := SetupDB(nil, "tx_expire_test", indexdb.TxTimeout(100*time.Millisecond), &User{})
+	defer db.Close()
+
+	tx := beginTx(t, db)
+	if err := tx.Exec("", createUserQuery("1", "Alice"), &User{}); err != nil {
+		t.Fatalf("Create in tx failed: %v", err)
+	}
+
+	// Neither committed nor rolled back: the connection's own calls wait for
+	// the transaction until it expires.
+	start := time.Now()
+	if err := readUserErr(db, "1"); err != storage.ErrNoRows {
+		t.Fatalf("Expected the expired transaction rolled back, got %v", err)
+	}
+	if waited := time.Since(start); waited > 5*time.Second {
+		t.Fatalf("Read waited %v for a forgotten transaction", waited)
+	}
+	if err := tx.Commit(); !errors.Is(err, indexdb.ErrTxExpired) {
+		t.Fatalf("Commit after expiry: got %v, want ErrTxExpired", err)
+	}
+}
+
+func TestCloseRollsBackTransaction(t *testing.T) {
+	db := SetupDB(nil, "tx_close_test", &User{})
+
+	tx := beginTx(t, db)
+	if err := tx.Exec("", createUserQuery("1", "Alice"), &User{}); err != nil {
+		t.Fatalf("Create in tx failed: %v", err)
+	}
+	_ = db.Close()
+	if err := tx.Commit(); err == nil {
+		t.Fatal("Expected Commit to fail after the connection closed")
+	}
+
+	db = SetupDB(nil, "tx_close_test", &User{})
+	defer db.Close()
+	if err := readUserErr(db, "1"); err != storage.ErrNoRows {
+		t.Fatalf("Expected the transaction rolled back on Close, got %v", err)
+	}
+}
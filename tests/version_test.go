@@ -0,0 +1,69 @@
+//go:build wasm
+
+package tests_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tinywasm/indexdb"
+)
+
+func TestVersionChangeCloseAndNotify(t *testing.T) {
+	dbName := "version_notify_test"
+
+	var events []indexdb.VersionEvent
+	oldTab := SetupDB(nil, dbName, indexdb.OnVersionChange(indexdb.CloseAndNotify, func(e indexdb.VersionEvent) {
+		events = append(events, e)
+	}), &User{})
+	defer oldTab.Close()
+
+	// A newer app version declaring another store upgrades the database; it
+	// must not hang waiting for the old connection.
+	newTab := SetupDB(nil, dbName, &User{}, &Product{})
+	defer newTab.Close()
+
+	if len(events) != 1 || events[0].Blocked || events[0].NewVersion != events[0].OldVersion+1 {
+		t.Fatalf("Expected one version change event, got %+v", events)
+	}
+	if err := oldTab.Exec("", createUserQuery("1", "Alice"), &User{}); err == nil {
+		t.Fatal("Expected the closed connection to reject writes")
+	}
+	if err := newTab.Exec("", createUserQuery("1", "Alice"), &User{}); err != nil {
+		t.Fatalf("Upgraded connection failed: %v", err)
+	}
+}
+
+func TestVersionChangeCloseAndReopen(t *testing.T) {
+	dbName := "version_reopen_test"
+
+	changed := make(chan indexdb.VersionEvent, 1)
+	oldTab := SetupDB(nil, dbName, indexdb.OnVersionChange(indexdb.CloseAndReopen, func(e indexdb.VersionEvent) {
+		changed <- e
+	}), &User{})
+	defer oldTab.Close()
+
+	newTab := SetupDB(nil, dbName, &User{}, &Product{})
+	defer newTab.Close()
+
+	select {
+	case <-changed:
+	case <-time.After(time.Second):
+		t.Fatal("Expected a version change event")
+	}
+
+	// The old tab reconnects on its own once the upgrade completed.
+	var err error
+	for i := 0; i < 20; i++ {
+		if err = oldTab.Exec("", createUserQuery("1", "Alice"), &User{}); err == nil {
+			break
+		}
+		time.Sleep(25 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("Reopened connection failed: %v", err)
+	}
+	if err := readUserErr(newTab, "1"); err != nil {
+		t.Fatalf("Write from the reopened tab must be visible: %v", err)
+	}
+}
@@ -4,13 +4,21 @@ package indexdb
 
 import (
 	"syscall/js"
+	"time"
 
 	"github.com/tinywasm/fmt"
+	"github.com/tinywasm/storage"
 )
 
 // processCursorRequest handles an IndexedDB cursor request (openCursor).
 // It iterates over the cursor and calls the provided callback for each item.
 func processCursorRequest(req js.Value, onNext func(cursor js.Value) bool) error {
+	return walkCursor(req, 0, onNext)
+}
+
+// walkCursor is processCursorRequest that first jumps over skip records with
+// a single cursor.advance instead of visiting them one by one.
+func walkCursor(req js.Value, skip int, onNext func(cursor js.Value) bool) error {
 	done := make(chan struct{})
 	var err error
 
@@ -28,6 +36,12 @@ func processCursorRequest(req js.Value, onNext func(cursor js.Value) bool) error
 			return nil
 		}
 
+		if skip > 0 {
+			cursor.Call("advance", skip)
+			skip = 0
+			return nil
+		}
+
 		// Process current item
 		shouldContinue := onNext(cursor)
 
@@ -42,12 +56,7 @@ func processCursorRequest(req js.Value, onNext func(cursor js.Value) bool) error
 	defer onSuccess.Release()
 
 	onError := js.FuncOf(func(this js.Value, args []js.Value) any {
-		errVal := req.Get("error")
-		errMsg := "Unknown IndexedDB cursor error"
-		if errVal.Truthy() {
-			errMsg = errVal.Get("message").String()
-		}
-		err = fmt.Err("IndexedDB cursor failed:", errMsg)
+		err = storeError(req.Get("error"), "", fmt.Err("Unknown IndexedDB cursor error"))
 		// Only close done on error if not already closed
 		select {
 		case <-done:
@@ -66,10 +75,11 @@ func processCursorRequest(req js.Value, onNext func(cursor js.Value) bool) error
 }
 
 // Transaction helper to start a transaction and get the object store.
-// mode should be "readonly" or "readwrite".
-func (d *adapter) getStore(tableName string, mode string) (js.Value, error) {
-	if !d.db.Truthy() {
-		return js.Value{}, fmt.Err("Database not initialized")
+// mode should be "readonly" or "readwrite". When t is not nil the store is
+// taken from that explicit transaction instead.
+func (d *adapter) getStore(t *transaction, tableName string, mode string) (js.Value, error) {
+	if err := d.ready(); err != nil {
+		return js.Value{}, err
 	}
 
 	// Pre-check object store existence. Calling transaction() with an unknown
@@ -80,6 +90,10 @@ func (d *adapter) getStore(tableName string, mode string) (js.Value, error) {
 		return js.Value{}, fmt.Err("Object store", tableName, "not found")
 	}
 
+	if t != nil {
+		return t.objectStore(tableName)
+	}
+
 	tx := d.db.Call("transaction", tableName, mode)
 	if !tx.Truthy() {
 		return js.Value{}, fmt.Err("Failed to create transaction for table", tableName)
@@ -92,3 +106,258 @@ func (d *adapter) getStore(tableName string, mode string) (js.Value, error) {
 
 	return store, nil
 }
+
+// awaitTx waits for an auto-commit transaction to complete and reports why
+// it aborted, if it did.
+func awaitTx(tx js.Value, table string) error {
+	done := make(chan error, 1)
+	onComplete := js.FuncOf(func(this js.Value, args []js.Value) any {
+		done <- nil
+		return nil
+	})
+	defer onComplete.Release()
+	onAbort := js.FuncOf(func(this js.Value, args []js.Value) any {
+		done <- storeError(tx.Get("error"), table, ErrAborted)
+		return nil
+	})
+	defer onAbort.Release()
+
+	tx.Call("addEventListener", "complete", onComplete)
+	tx.Call("addEventListener", "abort", onAbort)
+	return <-done
+}
+
+// transaction runs every action inside one readwrite IDBTransaction spanning
+// all declared stores. It implements storage.TxBoundExecutor.
+//
+// IndexedDB commits a transaction on its own as soon as it has no pending
+// request at the end of a task, and every blocking call in Go yields to the
+// event loop. To keep the transaction open between the caller's statements a
+// cheap keep-alive request is chained until Commit or Rollback.
+//
+// While it is open every other transaction on the database waits, including
+// the calls made on the connection itself. A forgotten transaction would
+// block them forever, so it is rolled back after TxTimeout and reports
+// ErrTxExpired; closing the connection rolls it back as well.
+type transaction struct {
+	d      *adapter
+	tx     js.Value
+	stores []string
+
+	ping    js.Func
+	closing bool
+	expired bool
+
+	done     chan struct{}
+	finished bool
+	aborted  bool
+	err      error
+
+	listeners []js.Func
+	released  bool
+
+	changes []Change // published once the transaction commits
+}
+
+// BeginTx implements storage.TxExecutor. Calls made on the connection itself
+// while the transaction is open wait for it to finish, so they must not be
+// issued from the goroutine that owns the transaction.
+func (d *adapter) BeginTx() (storage.TxBoundExecutor, error) {
+	if err := d.ready(); err != nil {
+		return nil, err
+	}
+
+	storeNames := d.db.Get("objectStoreNames")
+	var scope []any
+	var stores []string
+	for _, s := range d.specs {
+		if domStringListHas(storeNames, s.name) {
+			scope = append(scope, s.name)
+			stores = append(stores, s.name)
+		}
+	}
+	if len(scope) == 0 {
+		return nil, fmt.Err("no object stores to open a transaction on")
+	}
+
+	t := &transaction{
+		d:      d,
+		tx:     d.db.Call("transaction", scope, "readwrite"),
+		stores: stores,
+		done:   make(chan struct{}),
+	}
+	t.listen("complete", func() { t.finish(false, nil) })
+	t.listen("abort", func() { t.finish(true, t.abortReason()) })
+
+	lifetime := d.txTimeout
+	if lifetime <= 0 {
+		lifetime = defaultTxTimeout
+	}
+	t.keepAlive(t.tx.Call("objectStore", stores[0]), lifetime)
+	d.txs[t] = true
+	return t, nil
+}
+
+func (t *transaction) listen(event string, fn func()) {
+	f := js.FuncOf(func(this js.Value, args []js.Value) any {
+		fn()
+		return nil
+	})
+	t.listeners = append(t.listeners, f)
+	t.tx.Call("addEventListener", event, f)
+}
+
+// defaultTxTimeout is how long a transaction may stay open without TxTimeout.
+const defaultTxTimeout = 30 * time.Second
+
+// keepAlive chains a lookup of an absent key on store until closing is set,
+// and rolls the transaction back once it has been open for lifetime.
+func (t *transaction) keepAlive(store js.Value, lifetime time.Duration) {
+	deadline := time.Now().Add(lifetime)
+	t.ping = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if t.closing || t.finished {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			t.d.logger("transaction open for more than", lifetime.String(), "rolled back")
+			t.expired = true
+			t.abort()
+			return nil
+		}
+		store.Call("get", "").Call("addEventListener", "success", t.ping)
+		return nil
+	})
+	store.Call("get", "").Call("addEventListener", "success", t.ping)
+}
+
+// abort stops the keep-alive and aborts the transaction without waiting for
+// the outcome.
+func (t *transaction) abort() {
+	if t.closing || t.finished {
+		return
+	}
+	t.closing = true
+	t.tx.Call("abort")
+}
+
+func (t *transaction) abortReason() error {
+	if t.expired {
+		return ErrTxExpired
+	}
+	return storeError(t.tx.Get("error"), "", ErrAborted)
+}
+
+func (t *transaction) finish(aborted bool, err error) {
+	if t.finished {
+		return
+	}
+	delete(t.d.txs, t)
+	t.finished = true
+	t.aborted = aborted
+	t.err = err
+	close(t.done)
+}
+
+// release waits for the transaction to end and frees its JS callbacks.
+func (t *transaction) release() {
+	<-t.done
+	if t.released {
+		return
+	}
+	t.released = true
+	t.ping.Release()
+	for _, f := range t.listeners {
+		f.Release()
+	}
+}
+
+func (t *transaction) objectStore(tableName string) (js.Value, error) {
+	if t.closing {
+		// Rolled back by TxTimeout or Close; wait for the abort to land.
+		<-t.done
+	}
+	if t.finished {
+		if t.err != nil {
+			return js.Value{}, t.err
+		}
+		return js.Value{}, fmt.Err("transaction already committed")
+	}
+	for _, name := range t.stores {
+		if name == tableName {
+			return t.tx.Call("objectStore", tableName), nil
+		}
+	}
+	return js.Value{}, fmt.Err("Object store", tableName, "not in transaction scope")
+}
+
+// Exec implements storage.Executor
+func (t *transaction) Exec(query string, args ...any) error {
+	return t.d.exec(t, args...)
+}
+
+// QueryRow implements storage.Executor
+func (t *transaction) QueryRow(query string, args ...any) storage.Scanner {
+	return t.d.queryRow(t, args...)
+}
+
+// Query implements storage.Executor
+func (t *transaction) Query(query string, args ...any) (storage.Rows, error) {
+	return t.d.query(t, args...)
+}
+
+// Commit stops the keep-alive, commits and waits for the outcome. A
+// transaction aborted by a failed request reports that failure here.
+func (t *transaction) Commit() error {
+	if t.finished {
+		t.release()
+		if t.aborted {
+			return t.err
+		}
+		return fmt.Err("transaction already committed")
+	}
+	if t.closing {
+		// Rolled back by TxTimeout or Close.
+		t.release()
+		return t.err
+	}
+	t.closing = true
+	// Without commit() support the transaction commits once the last
+	// keep-alive request settles.
+	if t.tx.Get("commit").Truthy() {
+		t.tx.Call("commit")
+	}
+	t.release()
+	if t.aborted {
+		return t.err
+	}
+	t.d.publish(t.changes...)
+	return nil
+}
+
+// Rollback aborts the transaction, discarding every write made through it.
+func (t *transaction) Rollback() error {
+	if t.finished {
+		t.release()
+		if t.aborted {
+			return nil
+		}
+		return fmt.Err("transaction already committed")
+	}
+	t.abort()
+	t.release()
+	return nil
+}
+
+// Close rolls back the transaction if it is still open.
+func (t *transaction) Close() error {
+	if t.finished {
+		t.release()
+		return nil
+	}
+	return t.Rollback()
+}
+
+var (
+	_ storage.TxExecutor      = (*adapter)(nil)
+	_ storage.TxBoundExecutor = (*transaction)(nil)
+)
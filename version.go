@@ -0,0 +1,113 @@
+//go:build wasm
+
+package indexdb
+
+import (
+	"syscall/js"
+
+	"github.com/tinywasm/fmt"
+)
+
+// VersionPolicy decides what an open connection does when another tab needs
+// to upgrade or delete the database. IndexedDB cannot proceed with the
+// upgrade until every other connection is closed.
+type VersionPolicy int
+
+const (
+	// CloseAndNotify closes the connection so the upgrade can run; later
+	// operations fail until the page is reloaded. This is the default.
+	CloseAndNotify VersionPolicy = iota
+	// CloseAndReopen closes the connection and reopens the upgraded
+	// database without altering its schema.
+	CloseAndReopen
+)
+
+// VersionEvent reports an upgrade involving another connection.
+type VersionEvent struct {
+	OldVersion int
+	NewVersion int  // 0 when the database is being deleted
+	Blocked    bool // this connection's upgrade waits for other tabs to close
+}
+
+// OnVersionChange sets the policy applied when another tab upgrades or deletes
+// the database. fn, which may be nil, is called after the policy ran, and
+// also when this adapter's own upgrade is blocked by other tabs; apps
+// typically prompt the user to reload from it.
+func OnVersionChange(policy VersionPolicy, fn func(VersionEvent)) Option {
+	return func(d *adapter) {
+		d.versionPolicy = policy
+		d.versionHandler = fn
+	}
+}
+
+func versionEvent(ev js.Value) VersionEvent {
+	e := VersionEvent{OldVersion: ev.Get("oldVersion").Int()}
+	if v := ev.Get("newVersion"); v.Type() == js.TypeNumber {
+		e.NewVersion = v.Int()
+	}
+	return e
+}
+
+// onBlocked handles the blocked event of this adapter's open request. The
+// request keeps waiting; the upgrade runs once the other tabs close.
+func (d *adapter) onBlocked(ev js.Value) {
+	e := versionEvent(ev)
+	e.Blocked = true
+	d.logger("upgrade of", d.dbName, "to version", e.NewVersion, "blocked by other open connections")
+	if d.versionHandler != nil {
+		d.versionHandler(e)
+	}
+}
+
+// watchVersionChange listens for versionchange on the opened connection.
+func (d *adapter) watchVersionChange() {
+	if !d.versionListening {
+		d.versionListening = true
+		d.versionListener = js.FuncOf(func(this js.Value, args []js.Value) any {
+			d.onVersionChange(args[0])
+			return nil
+		})
+	}
+	d.db.Call("addEventListener", "versionchange", d.versionListener)
+}
+
+func (d *adapter) onVersionChange(ev js.Value) {
+	e := versionEvent(ev)
+
+	conn := ev.Get("target")
+	conn.Call("close")
+	if conn.Equal(d.db) {
+		d.db = js.Value{}
+		d.connErr = fmt.Err("connection to", d.dbName, "closed for an upgrade by another tab")
+	}
+	d.logger("closed", d.dbName, "for version change", e.OldVersion, "->", e.NewVersion)
+
+	if d.versionPolicy == CloseAndReopen && e.NewVersion > 0 {
+		// The open request waits until the other tab's upgrade completes.
+		go d.reopen()
+	}
+	if d.versionHandler != nil {
+		d.versionHandler(e)
+	}
+}
+
+// reopen opens the current version again. The schema is never upgraded from
+// here: a newer app version owns it now.
+func (d *adapter) reopen() {
+	if err := d.openDB(0); err != nil {
+		d.logger(err)
+		return
+	}
+	d.connErr = nil
+	if d.schemaDrifted() {
+		d.logger("schema of", d.dbName, "was changed by a newer version of the app - reload to use it")
+	}
+}
+
+// stopVersionWatch frees the versionchange callback.
+func (d *adapter) stopVersionWatch() {
+	if d.versionListening {
+		d.versionListening = false
+		d.versionListener.Release()
+	}
+}